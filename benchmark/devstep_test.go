@@ -0,0 +1,60 @@
+package multicell_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+var benchModels = []string{"Full", "Hie2", "Hie1", "NoHie"}
+
+// Matrix-vector products of all genome matrices: maps vs. CSR.
+func BenchmarkMultSpMatVec(b *testing.B) {
+	for _, model := range benchModels {
+		s := multicell.GetDefaultSetting(model)
+		g := s.NewGenome()
+		dg := g.Compile(s)
+		vin := multicell.NewVec(slices.Max(s.LenLayer), 1.0)
+		b.Run(model+"/Map", func(b *testing.B) {
+			for range b.N {
+				for l, from := range dg.From {
+					vout := make(multicell.Vec, s.LenLayer[l])
+					for _, k := range from {
+						vout.MultSpMatVec(g.M[l][k], vin[:s.LenLayer[k]])
+					}
+				}
+			}
+		})
+		b.Run(model+"/CSR", func(b *testing.B) {
+			for range b.N {
+				for l, from := range dg.From {
+					vout := make(multicell.Vec, s.LenLayer[l])
+					for n, k := range from {
+						vout.MultCSRVec(dg.M[l][n], vin[:s.LenLayer[k]])
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDevelop(b *testing.B) {
+	for _, model := range benchModels {
+		for _, ncell := range []int{1, 4} {
+			s := multicell.GetDefaultSetting(model)
+			s.NumCellX = ncell
+			env := s.NewEnvironment()
+			indiv := s.NewIndividual(s.Rand(), 0, env)
+			indiv.Genome = s.NewGenome()
+			b.Run(fmt.Sprintf("%s/%dcells", model, ncell), func(b *testing.B) {
+				b.ReportAllocs()
+				for range b.N {
+					indiv.Initialize(s, env)
+					indiv.Develop(s.Rand(), s, env)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package multicell_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+// Generations of evolution; reports allocations and GC pause time per generation.
+func BenchmarkGeneration(b *testing.B) {
+	dir := b.TempDir()
+	for _, npop := range []int{500, 1000} {
+		s := multicell.GetDefaultSetting("Full")
+		s.Outdir = dir
+		s.MaxPopulation = npop
+		envs := s.SaveEnvs(filepath.Join(dir, "envs.json"), 2)
+		pop := s.NewPopulation(envs[0])
+		b.Run(fmt.Sprintf("pop%d", npop), func(b *testing.B) {
+			devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+			multicell.JustFail(err)
+			stdout := os.Stdout
+			os.Stdout = devnull
+			log.SetOutput(io.Discard)
+			defer func() {
+				devnull.Close()
+				os.Stdout = stdout
+				log.SetOutput(os.Stderr)
+			}()
+			s.MaxGeneration = b.N
+			var m0, m1 runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&m0)
+			b.ReportAllocs()
+			b.ResetTimer()
+			pop.Evolve(s, envs[1])
+			b.StopTimer()
+			runtime.ReadMemStats(&m1)
+			b.ReportMetric(float64(m1.PauseTotalNs-m0.PauseTotalNs)/float64(b.N), "gc-ns/op")
+			b.ReportMetric(float64(m1.NumGC-m0.NumGC)/float64(b.N), "gcs/op")
+		})
+	}
+}
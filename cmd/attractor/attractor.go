@@ -0,0 +1,73 @@
+package main
+
+// Classify the developmental dynamics (fixed point, cycle, chaos) of
+// the individuals in trajectory files, and summarize them per generation.
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+type Simulation struct {
+	Setting *multicell.Setting
+	Envs    []multicell.Environment
+	Ienv    int  // environment (-1: the epoch of the trajectory)
+	Each    bool // print each individual
+	Files   []string
+}
+
+func GetSetting() Simulation {
+	settingP := flag.String("setting", "", "saved settings file")
+	envsfileP := flag.String("envs", "", "saved environments JSON file")
+	ienvP := flag.Int("env", -1, "environment to develop in (default: the one in effect in the trajectory)")
+	eachP := flag.Bool("each", false, "print the attractor of each individual")
+	seedP := flag.Uint64("seed", 13, "random seed")
+	flag.Parse()
+
+	if *settingP == "" {
+		log.Fatal("specify a settings file with -setting")
+	}
+	s := multicell.LoadSetting(*settingP)
+	s.SetSeed(*seedP)
+
+	if *envsfileP == "" {
+		log.Fatal("specify an environments file with -envs")
+	}
+	envs := s.LoadEnvs(*envsfileP)
+
+	return Simulation{
+		Setting: s,
+		Envs:    envs,
+		Ienv:    *ienvP,
+		Each:    *eachP,
+		Files:   flag.Args()}
+}
+
+func main() {
+	t0 := time.Now()
+	sim := GetSetting()
+	s := sim.Setting
+	for _, traj := range sim.Files {
+		pop := s.LoadPopulation(traj)
+		env := pop.Env
+		if sim.Ienv >= 0 {
+			env = sim.Envs[sim.Ienv]
+		} else if len(env) == 0 { // older dumps have no Env
+			env = sim.Envs[pop.Iepoch]
+		}
+		atts := pop.Attractors(s, env)
+		if sim.Each {
+			for i, att := range atts {
+				fmt.Printf("#\t%d\t%d\t%d\t%s\t%d\t%e\t%e\n",
+					pop.Iepoch, pop.Igen, i, att.Kind, att.Period,
+					att.Lyapunov, att.SpectralRadius)
+			}
+		}
+		multicell.GetAttractorStats(atts).Print(pop.Iepoch, pop.Igen)
+	}
+	log.Println("Time: ", time.Since(t0))
+}
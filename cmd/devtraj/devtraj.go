@@ -0,0 +1,94 @@
+package main
+
+// Replay the development of saved individuals and record their trajectories.
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+type Simulation struct {
+	Setting *multicell.Setting
+	Envs    []multicell.Environment
+	Ienv    int   // environment (-1: the epoch of the trajectory)
+	Indivs  []int // indices of individuals (sorted by fitness)
+	Files   []string
+}
+
+func GetSetting() Simulation {
+	settingP := flag.String("setting", "", "saved settings file")
+	envsfileP := flag.String("envs", "", "saved Environments JSON file")
+	ienvP := flag.Int("env", -1, "environment to develop in (default: the epoch of the trajectory)")
+	indivP := flag.String("indiv", "0", "comma-separated indices of individuals (sorted by fitness)")
+	seedP := flag.Uint64("seed", 13, "random seed for cue noise")
+	outdirP := flag.String("outdir", "devtraj", "output directory")
+	flag.Parse()
+
+	if *settingP == "" {
+		log.Fatal("specify a settings file with -setting")
+	}
+	s := multicell.LoadSetting(*settingP)
+	s.SetSeed(*seedP)
+	s.Outdir = *outdirP
+	JustMkdir(s.Outdir)
+	if *envsfileP == "" {
+		log.Fatal("specify environment file with -envs")
+	}
+	envs := s.LoadEnvs(*envsfileP)
+
+	var indivs []int
+	for _, f := range strings.Split(*indivP, ",") {
+		i, err := strconv.Atoi(f)
+		multicell.JustFail(err)
+		indivs = append(indivs, i)
+	}
+
+	return Simulation{
+		Setting: s,
+		Envs:    envs,
+		Ienv:    *ienvP,
+		Indivs:  indivs,
+		Files:   flag.Args()}
+}
+
+func JustMkdir(dir string) {
+	multicell.JustFail(os.MkdirAll(dir, 0755))
+}
+
+func main() {
+	t0 := time.Now()
+	sim := GetSetting()
+	s := sim.Setting
+
+	for _, traj := range sim.Files {
+		pop := s.LoadPopulation(traj)
+		pop.SortByFitness()
+		ienv := sim.Ienv
+		if ienv < 0 {
+			ienv = pop.Iepoch
+		}
+		env := sim.Envs[ienv]
+		for _, i := range sim.Indivs {
+			if i >= len(pop.Indivs) {
+				log.Fatalf("%s: no individual %d\n", traj, i)
+			}
+			indiv := pop.Indivs[i]
+			indiv.Initialize(s, env)
+			rec := s.NewDevRecorder(len(indiv.Cells))
+			indiv.DevelopRecord(s.Rand(), s, env, rec)
+			basename := fmt.Sprintf("%s/%s_%2.2d_%3.3d_env%2.2d_%3.3d",
+				s.Outdir, s.Basename, pop.Iepoch, pop.Igen, ienv, i)
+			rec.Save(basename, &indiv, pop.Iepoch, pop.Igen)
+			fmt.Printf("%s\t%d\t%d\t%f\t%e\n", basename, i, indiv.Ndev, indiv.Align, indiv.Fitness)
+		}
+	}
+
+	log.Println("Time: ", time.Since(t0))
+}
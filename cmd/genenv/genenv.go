@@ -20,34 +20,69 @@ func main() {
 	denvP := flag.Float64("denv", 0.5, "degree of environmental change")
 	replaceP := flag.Int("replace", 0, "replace new environments after the epoch. should be >0.")
 	seedP := flag.Uint64("seed", 13, "random seed for environments")
+	latticeP := flag.String("lattice", "Rect", "cell lattice: Rect, Torus, Hex or HexTorus")
+	ncellxP := flag.Int("ncellx", 1, "number of cells in the x-axis")
+	ncellyP := flag.Int("ncelly", 1, "number of cells in the y-axis")
+	genP := flag.String("gen", "BlockWalk", "generator: BlockWalk, Hamming, Alternating, Returning, Orthogonal, Correlated, GaussWalk")
+	paramP := flag.Float64("corr", 0.5, "pairwise correlation of Correlated environments")
+	contP := flag.Bool("continuous", false, "real-valued environments (uniform in [-1, 1])")
+	spatialP := flag.String("spatial", "", "spatial environments: Edges, Gradient or Random (default: uniform)")
 	flag.Parse()
 
 	s := multicell.GetDefaultSetting("Full")
+	s.Lattice = *latticeP
+	s.NumCellX = *ncellxP
+	s.NumCellY = *ncellyP
+	s.SpatialEnv = *spatialP != ""
+	s.ContinuousEnv = *contP
 
-	s.Seed = *seedP
+	if s.ContinuousEnv && s.SpatialEnv {
+		log.Fatal("-continuous and -spatial cannot be combined")
+	}
+
+	s.SetSeed(*seedP)
 	s.Denv = *denvP
 
-	log.Printf("Seed=%d; Denv=%f\n", s.Seed, s.Denv)
+	log.Printf("Seed=%d; Denv=%f; Generator=%s\n", s.Seed, s.Denv, *genP)
+	generate := multicell.GetEnvGenerator(*genP)
+	param := 0.0 // only Correlated has a parameter.
+	if *genP == "Correlated" {
+		param = *paramP
+	}
 
 	var env0 multicell.Environment
 	var envs multicell.EnvironmentS
+	var base *multicell.EnvHeader
 	if *outfileP == "" {
 		panic("Specify output file!")
 	}
 	if *replaceP <= 0 {
-		env0 = s.NewEnvironment()
-		envs = env0.GenerateEnvs(s, *nenvsP)
+		if s.ContinuousEnv {
+			env0 = s.NewContinuousEnvironment()
+		} else if s.SpatialEnv {
+			env0 = s.NewSpatialEnvironment(*spatialP)
+		} else {
+			env0 = s.NewEnvironment()
+		}
+		envs = generate(s, env0, *nenvsP, param)
 	} else {
 		if *envsfileP == "" {
 			panic("Provide environment file with -envs!")
 		}
-		aenvs := s.LoadEnvs(*envsfileP)
+		ef := s.LoadEnvFile(*envsfileP)
+		aenvs := ef.Envs
+		base = &ef.EnvHeader
 		env0 = aenvs[*replaceP-1]
-		nenvs := env0.GenerateEnvs(s, *nenvsP+1)
+		nenvs := generate(s, env0, *nenvsP+1, param)
 		envs = append(aenvs[0:*replaceP], nenvs[1:]...)
 	}
 
-	envs.DumpEnvs(*outfileP)
+	ef := s.NewEnvFile(*genP, param, envs)
+	if base != nil {
+		ef.Replace = *replaceP
+		ef.Base = base
+	}
+	ef.Dump(*outfileP)
 	log.Printf("Brand new environments saved in: %s\n", *outfileP)
 
 }
@@ -0,0 +1,84 @@
+package main
+
+// Export genomes as gene regulatory networks in GraphML, DOT and JSON.
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+type Simulation struct {
+	Setting *multicell.Setting
+	Indiv   int     // individual (sorted by fitness); -1 for the consensus
+	MinFreq float64 // minimum frequency of consensus edges
+	Formats []string
+	Files   []string
+}
+
+func GetSetting() Simulation {
+	settingP := flag.String("setting", "", "saved settings file")
+	indivP := flag.Int("indiv", -1, "individual (sorted by fitness; -1: consensus of the population)")
+	minfreqP := flag.Float64("minfreq", 0.5, "minimum frequency of edges in the consensus")
+	formatP := flag.String("format", "graphml,dot,json", "comma-separated output formats")
+	outdirP := flag.String("outdir", "grn", "output directory")
+	flag.Parse()
+
+	if *settingP == "" {
+		log.Fatal("specify a settings file with -setting")
+	}
+	s := multicell.LoadSetting(*settingP)
+	s.Outdir = *outdirP
+	multicell.JustFail(os.MkdirAll(s.Outdir, 0755))
+
+	return Simulation{
+		Setting: s,
+		Indiv:   *indivP,
+		MinFreq: *minfreqP,
+		Formats: strings.Split(*formatP, ","),
+		Files:   flag.Args()}
+}
+
+func main() {
+	t0 := time.Now()
+	sim := GetSetting()
+	s := sim.Setting
+	for _, traj := range sim.Files {
+		pop := s.LoadPopulation(traj)
+		pop.SortByFitness()
+		var grn multicell.GRN
+		label := "consensus"
+		if sim.Indiv < 0 {
+			grn = s.ConsensusGRN(pop.Genomes(), sim.MinFreq)
+		} else {
+			if sim.Indiv >= len(pop.Indivs) {
+				log.Fatalf("%s: no individual %d\n", traj, sim.Indiv)
+			}
+			grn = s.GenomeGRN(pop.Indivs[sim.Indiv].Genome)
+			label = fmt.Sprintf("%3.3d", sim.Indiv)
+		}
+		for _, format := range sim.Formats {
+			filename := s.TrajectoryFilename(pop.Iepoch, pop.Igen, label+"."+format)
+			fout, err := os.Create(filename)
+			multicell.JustFail(err)
+			switch format {
+			case "graphml":
+				grn.WriteGraphML(fout)
+			case "dot":
+				grn.WriteDOT(fout)
+			case "json":
+				grn.WriteJSON(fout)
+			default:
+				log.Fatal("Unknown format: " + format)
+			}
+			fout.Close()
+			log.Printf("Network saved in: %s\n", filename)
+		}
+	}
+	log.Println("Time: ", time.Since(t0))
+}
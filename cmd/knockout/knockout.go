@@ -0,0 +1,87 @@
+package main
+
+// Knockout experiments: rank genome elements by their effects on
+// development in the ancestral and novel environments.
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+type Simulation struct {
+	Setting *multicell.Setting
+	Envs    []multicell.Environment
+	Ianc    int    // ancestral environment (-1: the epoch before the trajectory)
+	Inov    int    // novel environment (-1: the epoch of the trajectory)
+	Kind    string // kind of knockouts
+	Nindiv  int    // number of the fittest individuals (0: all)
+	Files   []string
+}
+
+func GetSetting() Simulation {
+	settingP := flag.String("setting", "", "saved settings file")
+	envsfileP := flag.String("envs", "", "saved environments JSON file")
+	iancP := flag.Int("anc", -1, "ancestral environment (default: the epoch before the trajectory)")
+	inovP := flag.Int("nov", -1, "novel environment (default: the epoch of the trajectory)")
+	kindP := flag.String("kind", "Row", "knockouts: Row, Col, Edge or Link")
+	nindivP := flag.Int("nindiv", 0, "number of the fittest individuals to use (0: all)")
+	outdirP := flag.String("outdir", "knockout", "output directory")
+	flag.Parse()
+
+	if *settingP == "" {
+		log.Fatal("specify a settings file with -setting")
+	}
+	s := multicell.LoadSetting(*settingP)
+	s.Outdir = *outdirP
+	multicell.JustFail(os.MkdirAll(s.Outdir, 0755))
+
+	if *envsfileP == "" {
+		log.Fatal("specify an environments file with -envs")
+	}
+	envs := s.LoadEnvs(*envsfileP)
+
+	return Simulation{
+		Setting: s,
+		Envs:    envs,
+		Ianc:    *iancP,
+		Inov:    *inovP,
+		Kind:    *kindP,
+		Nindiv:  *nindivP,
+		Files:   flag.Args()}
+}
+
+func main() {
+	t0 := time.Now()
+	sim := GetSetting()
+	s := sim.Setting
+	for _, traj := range sim.Files {
+		pop := s.LoadPopulation(traj)
+		if sim.Nindiv > 0 && sim.Nindiv < len(pop.Indivs) {
+			pop.SortByFitness()
+			pop.Indivs = pop.Indivs[:sim.Nindiv]
+		}
+		ianc, inov := sim.Ianc, sim.Inov
+		if ianc < 0 {
+			ianc = max(0, pop.Iepoch-1)
+		}
+		if inov < 0 {
+			inov = pop.Iepoch
+		}
+		kos := s.GetKnockouts(sim.Kind, pop.Genomes())
+
+		filename := s.TrajectoryFilename(pop.Iepoch, pop.Igen, "knockout")
+		fout, err := os.Create(filename)
+		multicell.JustFail(err)
+		multicell.PrintKnockoutEffects(fout, "Anc",
+			pop.KnockoutEffects(s, sim.Envs[ianc], kos))
+		multicell.PrintKnockoutEffects(fout, "Nov",
+			pop.KnockoutEffects(s, sim.Envs[inov], kos))
+		fout.Close()
+		log.Printf("Knockouts saved in: %s\n", filename)
+	}
+	log.Println("Time: ", time.Since(t0))
+}
@@ -0,0 +1,57 @@
+package main
+
+// Network motifs, modularity and degree distributions of the genomes
+// in trajectory files, one set of lines per generation.
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+type Simulation struct {
+	Setting *multicell.Setting
+	Nnull   int // randomized networks per genome
+	Nindiv  int // number of the fittest individuals (0: all)
+	Files   []string
+}
+
+func GetSetting() Simulation {
+	settingP := flag.String("setting", "", "saved settings file")
+	nnullP := flag.Int("nnull", 10, "number of degree-preserving randomized networks per genome")
+	nindivP := flag.Int("nindiv", 0, "number of the fittest individuals to use (0: all)")
+	seedP := flag.Uint64("seed", 13, "random seed")
+	flag.Parse()
+
+	if *settingP == "" {
+		log.Fatal("specify a settings file with -setting")
+	}
+	s := multicell.LoadSetting(*settingP)
+	s.SetSeed(*seedP)
+
+	return Simulation{
+		Setting: s,
+		Nnull:   *nnullP,
+		Nindiv:  *nindivP,
+		Files:   flag.Args()}
+}
+
+func main() {
+	t0 := time.Now()
+	sim := GetSetting()
+	s := sim.Setting
+	multicell.PrintNetStatsHeader(os.Stdout)
+	for _, traj := range sim.Files {
+		pop := s.LoadPopulation(traj)
+		if sim.Nindiv > 0 && sim.Nindiv < len(pop.Indivs) {
+			pop.SortByFitness()
+			pop.Indivs = pop.Indivs[:sim.Nindiv]
+		}
+		stats := pop.GetNetStats(s, sim.Nnull)
+		multicell.PrintNetStats(os.Stdout, pop.Iepoch, pop.Igen, stats)
+	}
+	log.Println("Time: ", time.Since(t0))
+}
@@ -0,0 +1,74 @@
+package main
+
+// Genetic robustness and environmental canalization along a trajectory.
+// The table is written next to the output of gpplot.
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+type Simulation struct {
+	Setting *multicell.Setting
+	Envs    []multicell.Environment
+	Iepoch  int
+	K       int      // realizations of each perturbation
+	Files   []string // trajectory files
+}
+
+func GetSetting() Simulation {
+	settingP := flag.String("setting", "", "saved settings file")
+	envsfileP := flag.String("envs", "", "saved environments JSON file")
+	ienvP := flag.Int("ienv", 1, "index of the environment")
+	kP := flag.Int("k", 10, "number of mutants and of cue-noise realizations per individual")
+	seedP := flag.Uint64("seed", 13, "random seed")
+
+	flag.Parse()
+
+	if *settingP == "" {
+		log.Fatal("specify a settings file with -setting")
+	}
+	s := multicell.LoadSetting(*settingP)
+	s.SetSeed(*seedP)
+	s.Outdir = "gpplot"
+	s.Basename += fmt.Sprintf("_ep%2.2d", *ienvP)
+
+	if *envsfileP == "" {
+		log.Fatal("specify an environments file with -envs")
+	}
+	envs := s.LoadEnvs(*envsfileP)
+
+	return Simulation{
+		Setting: s,
+		Envs:    envs,
+		Iepoch:  *ienvP,
+		K:       *kP,
+		Files:   flag.Args()}
+}
+
+func main() {
+	t0 := time.Now()
+	sim := GetSetting()
+	s := sim.Setting
+	env := sim.Envs[sim.Iepoch]
+
+	multicell.JustFail(os.MkdirAll(s.Outdir, 0755))
+	filename := fmt.Sprintf("%s/%s.robust", s.Outdir, s.Basename)
+	fout, err := os.Create(filename)
+	multicell.JustFail(err)
+	defer fout.Close()
+
+	multicell.PrintRobustnessHeader(fout)
+	for _, traj := range sim.Files {
+		pop := s.LoadPopulation(traj)
+		robs := pop.Robustness(s, env, sim.K)
+		multicell.PrintRobustness(fout, pop.Iepoch, pop.Igen, robs)
+	}
+	log.Printf("Robustness saved in: %s\n", filename)
+	log.Println("Time: ", time.Since(t0))
+}
@@ -5,47 +5,152 @@ import (
 	//	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/arkinjo/evodevo3/multicell"
 )
 
 type Simulation struct {
-	Setting *multicell.Setting
-	Envs    []multicell.Environment
-	Pop     multicell.Population
-	Estart  int
-	Eend    int
+	Setting    *multicell.Setting
+	Envs       []multicell.Environment
+	Pop        multicell.Population
+	Checkpoint *multicell.Checkpoint // resume from here if not nil
+	Estart     int
+	Eend       int
 }
 
 func GetSetting() Simulation {
 	maxpopP := flag.Int("popsize", 500, "population size")
+	workersP := flag.Int("workers", 0, "number of worker goroutines (0: GOMAXPROCS)")
 	envsfileP := flag.String("envs", "", "saved environments JSON file")
 	resfileP := flag.String("restart", "", "saved restart population file")
+	resumeP := flag.String("resume", "", "checkpoint file to resume from")
+	ckptP := flag.Int("checkpoint", 0, "save a checkpoint every n generations (0: never)")
 	settingP := flag.String("setting", "", "saved settings file")
 	envflipP := flag.Bool("envflip", false, "learn plasticity")
+	envdynP := flag.String("envdyn", "", "environmental dynamics: Static, BlockFlipNR, BlockFlip, Markov, Periodic, RedNoise (default: BlockFlipNR with -envflip, otherwise Static)")
+	penv01P := flag.Float64("penv01", 0.05, "probability of a block deviating from the environment (Markov, BlockFlip, RedNoise)")
+	penv10P := flag.Float64("penv10", 0.2, "probability of a block returning to the environment (Markov, RedNoise)")
+	envperiodP := flag.Int("envperiod", 20, "generations per cycle (Periodic)")
+	envcorrP := flag.Float64("envcorr", 0.9, "lag-1 correlation (RedNoise)")
 
 	trajDirP := flag.String("trajdir", "traj", "Directory for trajectory files")
 	eStartP := flag.Int("env_start", 0, "starting environment (0, 1, ...)")
 	eEndP := flag.Int("env_end", 20, "ending environment")
-	seedP := flag.Uint64("seed", 13, "random seed for environments")
+	seedP := flag.Uint64("seed", 13, "random seed")
 	ngenP := flag.Int("ngen", 200, "number of generations per epoch")
 	prodP := flag.Bool("production", false, "true if production run")
-	modelP := flag.String("model", "Full", "Model name")
+	modelP := flag.String("model", "Full", "Model name or model JSON file")
+	selP := flag.String("selection", "Rejection", "selection scheme: Rejection, WrightFisher, Tournament, Truncation, Rank, MuLambda")
+	selparP := flag.Float64("selparam", 0, "parameter of the selection scheme (0: default)")
+	elitesP := flag.Int("elites", 0, "number of elites carried over unchanged")
+	extinctP := flag.String("extinction", "Drift", "when all fitness is 0: Drift or Abort")
+	fitnessP := flag.String("fitness", "Exponential", "fitness function: Exponential or Gaussian")
+	alignP := flag.String("align", "Dot", "alignment metric: Dot, Corr, Hamming or MSD")
+	plastP := flag.Float64("plastcost", 0, "cost of plasticity")
+	selfacesP := flag.String("selfaces", "", "comma-separated weights of faces under selection (default: Left only)")
+	selwidthP := flag.Float64("selwidth", 0.5, "width of Gaussian stabilizing selection (with -fitness Gaussian)")
+	ndevfreeP := flag.Int("ndevfree", 50, "developmental steps without cost")
+	ndevcostP := flag.Float64("ndevcost", 0.1, "cost per extra developmental step")
+	biasP := flag.Bool("bias", false, "with biases in activation")
+	biasmutP := flag.Float64("biasmut", 0.002, "mutation rate of biases")
+	biasmodelP := flag.String("biasmodel", "Ternary", "bias mutation: Ternary or Gaussian")
+	latticeP := flag.String("lattice", "Rect", "cell lattice: Rect, Torus, Hex or HexTorus")
+	ncellxP := flag.Int("ncellx", 1, "number of cells in the x-axis")
+	ncellyP := flag.Int("ncelly", 1, "number of cells in the y-axis")
+	contP := flag.Bool("continuous", false, "real-valued environments with Gaussian cue noise")
+	cuesdP := flag.Float64("cuesd", 0.1, "standard deviation of Gaussian cue noise (with -continuous)")
+	cuerelP := flag.String("cuerel", "", "comma-separated correlations of cues with the environment per face (-1 to 1; default: 1)")
+	cuenoiseP := flag.String("cuenoise", "", "comma-separated cue noise per face (default: -cuesd or EnvNoise)")
+	cuelagP := flag.Int("cuelag", 0, "cues from the environment of n generations ago")
+	devcueP := flag.String("devcue", "Fixed", "cue during development: Fixed, Switch, Pulse, Ramp or Resample")
+	devcuestepP := flag.Int("devcuestep", 50, "developmental step of a cue switch, or the start of a pulse or ramp")
+	devcuelenP := flag.Int("devcuelen", 20, "steps of a cue pulse or ramp, or between resampled cues")
+	devrecP := flag.String("devrecord", "", "comma-separated developmental steps at which phenotypes are saved in trajectories")
+	recdevP := flag.String("recorddev", "", "comma-separated Ids of individuals whose developmental trajectories are saved with the dumps")
+	spatialP := flag.Bool("spatialenv", false, "spatial environments (a cue and target for each boundary face)")
+	actP := flag.String("activation", "", "comma-separated activation functions of layers (default: LCatan,...,CStep1)")
 	flag.Parse()
 
 	var s *multicell.Setting
-	if *settingP != "" {
+	var cp *multicell.Checkpoint
+	if *resumeP != "" {
+		var c multicell.Checkpoint
+		s, c = multicell.LoadCheckpoint(*resumeP)
+		cp = &c
+		*eStartP = cp.Pop.Iepoch
+	} else if *settingP != "" {
 		s = multicell.LoadSetting(*settingP)
 	} else {
 		s = multicell.GetDefaultSetting(*modelP)
+		s.NumCellX = *ncellxP
+		s.NumCellY = *ncellyP
+		s.SpatialEnv = *spatialP
+		s.ContinuousEnv = *contP
+		s.CueSD = *cuesdP
+		s.CueRel = parseVec(*cuerelP)
+		s.CueNoise = parseVec(*cuenoiseP)
+		s.CueLag = *cuelagP
+		s.DevCue = *devcueP
+		s.DevCueStep = *devcuestepP
+		s.DevCueLen = *devcuelenP
+		for _, x := range parseVec(*devrecP) {
+			s.DevRecord = append(s.DevRecord, int(x))
+		}
+		slices.Sort(s.DevRecord)
+		for _, x := range parseVec(*recdevP) {
+			s.RecordDev = append(s.RecordDev, int(x))
+		}
+		if *latticeP != s.Lattice {
+			s.Lattice = *latticeP
+			s.SetModel(*modelP) // layer lengths depend on the number of faces
+		}
+		s.CheckCues() // per face of the lattice
+		multicell.CheckDevCue(s.DevCue)
 		s.MaxPopulation = *maxpopP
 		s.MaxGeneration = *ngenP
 		s.Outdir = *trajDirP
 		s.EnvFlip = *envflipP
+		s.EnvDynamics = *envdynP
+		s.Penv01 = *penv01P
+		s.Penv10 = *penv10P
+		s.EnvPeriod = *envperiodP
+		s.EnvCorr = *envcorrP
+		s.GetEnvDynamics() // check the name and parameters
+		s.Selection = *selP
+		s.SelParam = *selparP
+		s.NumElites = *elitesP
+		s.Extinction = *extinctP
+		s.FitnessFunc = *fitnessP
+		s.AlignMetric = *alignP
+		s.PlastCost = *plastP
+		s.SelFaces = parseVec(*selfacesP)
+		s.SelWidth = *selwidthP
+		s.NdevFree = *ndevfreeP
+		s.NdevCost = *ndevcostP
+		s.CheckSelection()
+		s.WithBias = *biasP
+		s.BiasMutRate = *biasmutP
+		s.BiasModel = *biasmodelP
+		if *actP != "" {
+			s.Activation = strings.Split(*actP, ",")
+			if len(s.Activation) != s.NumLayers {
+				log.Fatalf("-activation: need %d functions", s.NumLayers)
+			}
+			for _, name := range s.Activation {
+				multicell.CheckActivation(name)
+			}
+		}
 	}
-	s.Seed = *seedP
-	s.ProductionRun = *prodP
+	if cp == nil {
+		s.SetSeed(*seedP)
+		s.ProductionRun = *prodP
+		s.CheckpointEvery = *ckptP
+	}
+	s.NumWorkers = *workersP
 
 	var envs []multicell.Environment
 
@@ -71,18 +176,35 @@ func GetSetting() Simulation {
 	}
 
 	var pop multicell.Population
-	if *resfileP != "" {
+	if cp != nil {
+		pop = cp.Pop
+	} else if *resfileP != "" {
 		pop = s.LoadPopulation(*resfileP)
 	} else {
 		pop = s.NewPopulation(envs[*eStartP])
 	}
 	return Simulation{
-		Setting: s,
-		Pop:     pop,
-		Envs:    envs,
-		Estart:  *eStartP,
-		Eend:    *eEndP}
+		Setting:    s,
+		Pop:        pop,
+		Checkpoint: cp,
+		Envs:       envs,
+		Estart:     *eStartP,
+		Eend:       *eEndP}
+
+}
 
+// Comma-separated numbers (nil if empty).
+func parseVec(str string) multicell.Vec {
+	if str == "" {
+		return nil
+	}
+	var vec multicell.Vec
+	for _, f := range strings.Split(str, ",") {
+		x, err := strconv.ParseFloat(f, 64)
+		multicell.JustFail(err)
+		vec = append(vec, x)
+	}
+	return vec
 }
 
 func main() {
@@ -91,8 +213,14 @@ func main() {
 	pop := sim.Pop
 	sim.Setting.Dump()
 	log.Println("pop size: ", len(pop.Indivs))
+	multicell.CatchSignals()
 	var dumpfile string
-	for iepoch := sim.Estart; iepoch < sim.Eend; iepoch++ {
+	estart := sim.Estart
+	if sim.Checkpoint != nil {
+		pop, dumpfile = sim.Checkpoint.Resume(sim.Setting)
+		estart++
+	}
+	for iepoch := estart; iepoch < sim.Eend; iepoch++ {
 		pop.Iepoch = iepoch
 		pop, dumpfile = pop.Evolve(sim.Setting, sim.Envs[iepoch])
 	}
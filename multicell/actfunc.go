@@ -1,11 +1,62 @@
 package multicell
 
 import (
+	"log"
 	"math"
 )
 
 // activation functions
 
+// Activation functions by name (Setting.Activation).
+var activations = map[string]func(float64) func(float64) float64{
+	"LCatan": LCatan,
+	"LCtanh": LCtanh,
+	"SCtanh": SCtanh,
+	"CStep1": CStep1,
+	"SStep3": SStep3,
+	"SStep5": SStep5,
+	"AStep3": AStep3,
+	"Atan":   Atan,
+	"Tanh":   Tanh,
+}
+
+const (
+	default_activation        = "LCatan" // input and hidden layers
+	default_output_activation = "CStep1"
+)
+
+func CheckActivation(name string) {
+	if _, ok := activations[name]; !ok {
+		log.Fatal("Unknown activation function: " + name)
+	}
+}
+
+// Default activation functions of nlayers layers.
+func DefaultActivation(nlayers int) []string {
+	names := make([]string, nlayers)
+	for l := range names {
+		names[l] = default_activation
+	}
+	names[nlayers-1] = default_output_activation
+	return names
+}
+
+// Activation function of layer l.
+// Settings without Activation (older files) use the defaults.
+func (s *Setting) GetActivation(l int) func(float64) float64 {
+	name := default_activation
+	if s.Activation != nil {
+		name = s.Activation[l]
+	} else if l == s.NumLayers-1 {
+		name = default_output_activation
+	}
+	af, ok := activations[name]
+	if !ok {
+		log.Fatal("Unknown activation function: " + name)
+	}
+	return af(s.Omega[l])
+}
+
 // LeCun-inspired arctan function
 func LCatan(omega float64) func(float64) float64 {
 	b := omega / Sqrt3
@@ -0,0 +1,235 @@
+package multicell
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+/*
+	Classification of developmental dynamics.
+
+	The state of an individual (all layers of all cells) is iterated by
+	DevStep under a fixed cue: MaxDevelop steps of transient, then
+	MaxDevelop steps of analysis. The last states classify the outcome:
+
+	"Fixed":     a fixed point (period 1).
+	"Cycle":     a periodic cycle with Period <= attractor_max_period.
+	"Chaotic":   neither, with a positive largest Lyapunov exponent.
+	"Transient": neither, without (slow or quasi-periodic dynamics).
+
+	The largest Lyapunov exponent is estimated by following a perturbed
+	copy of the state (Benettin's method) during the analysis steps.
+	The spectral radius of the Jacobian at a fixed point is estimated by
+	power iteration with finite-difference Jacobian-vector products.
+*/
+
+const (
+	attractor_tol        = 1e-6  // max. |x(t) - x(t-p)| of a period p
+	attractor_max_period = 64    // longest period detected
+	attractor_eps        = 1e-8  // size of perturbations
+	attractor_log_floor  = -30.0 // lower bound of log expansion per step
+	attractor_power_iter = 100   // power iterations (after as many for burn-in)
+)
+
+type Attractor struct {
+	Kind           string
+	Period         int     // 1 for a fixed point; 0 if not periodic
+	Lyapunov       float64 // largest Lyapunov exponent per step
+	SpectralRadius float64 // of the Jacobian at the fixed point; NaN otherwise
+}
+
+// State vectors of all layers of all cells.
+func cellsState(cells []Cell) Vec {
+	var x Vec
+	for _, c := range cells {
+		for _, sl := range c.S {
+			x = append(x, sl...)
+		}
+	}
+	return x
+}
+
+func setCellsState(cells []Cell, x Vec) {
+	i := 0
+	for _, c := range cells {
+		for _, sl := range c.S {
+			i += copy(sl, x[i:])
+		}
+	}
+}
+
+// One developmental step from the state x.
+func (s *Setting) devMap(g DevGenome, cells []Cell, x Vec) Vec {
+	setCellsState(cells, x)
+	for i := range cells {
+		cells[i].DevStep(s, g, 0)
+	}
+	return cellsState(cells)
+}
+
+// Random vector of length eps.
+func randomPerturbation(rng *rand.Rand, n int) Vec {
+	v := make(Vec, n)
+	for i := range v {
+		v[i] = rng.NormFloat64()
+	}
+	return v.ScaleBy(attractor_eps / v.Norm2())
+}
+
+// Classify the developmental dynamics of indiv's genome under cue (before noise).
+// indiv itself is not modified.
+func (indiv *Individual) Attractor(rng *rand.Rand, s *Setting, cue Environment) Attractor {
+	g := indiv.Genome.Compile(s)
+	noisy := s.NoisyCue(rng, cue)
+	work := s.NewIndividual(rng, indiv.Id, cue)
+	work.Initialize(s, cue)
+	s.SetCellCue(work.Cells, noisy)
+	pert := s.NewIndividual(rng, indiv.Id, cue)
+	s.SetCellCue(pert.Cells, noisy)
+
+	x := cellsState(work.Cells)
+	dx := randomPerturbation(rng, len(x))
+	xp := make(Vec, len(x))
+	var hist []Vec // the last attractor_max_period+2 states
+	lsum := 0.0
+	for istep := range 2 * s.MaxDevelop {
+		xp.Add(x, dx)
+		x = s.devMap(g, work.Cells, x)
+		y := s.devMap(g, pert.Cells, xp)
+		dx.Diff(y, x)
+		d := dx.Norm2()
+		if istep >= s.MaxDevelop {
+			lsum += max(attractor_log_floor, math.Log(d/attractor_eps))
+			hist = append(hist, x)
+			if len(hist) > attractor_max_period+2 {
+				hist = hist[1:]
+			}
+		}
+		if d == 0 {
+			dx = randomPerturbation(rng, len(x))
+		} else {
+			dx.ScaleBy(attractor_eps / d)
+		}
+	}
+
+	att := Attractor{
+		Lyapunov:       lsum / float64(s.MaxDevelop),
+		SpectralRadius: math.NaN()}
+	att.Period = detectPeriod(hist)
+	switch {
+	case att.Period == 1:
+		att.Kind = "Fixed"
+		att.SpectralRadius = s.spectralRadius(rng, g, work.Cells, hist[len(hist)-1])
+	case att.Period > 1:
+		att.Kind = "Cycle"
+	case att.Lyapunov > 0:
+		att.Kind = "Chaotic"
+	default:
+		att.Kind = "Transient"
+	}
+	return att
+}
+
+// Shortest period of the last two states in hist; 0 if none.
+func detectPeriod(hist []Vec) int {
+	n := len(hist)
+	if n < 3 {
+		return 0
+	}
+	dv := make(Vec, len(hist[0]))
+	for p := 1; p+1 < n; p++ {
+		periodic := true
+		for _, t := range []int{n - 1, n - 2} {
+			if dv.Diff(hist[t], hist[t-p]).NormInf() >= attractor_tol {
+				periodic = false
+				break
+			}
+		}
+		if periodic {
+			return p
+		}
+	}
+	return 0
+}
+
+// Spectral radius of the Jacobian of devMap at the fixed point x.
+func (s *Setting) spectralRadius(rng *rand.Rand, g DevGenome, cells []Cell, x Vec) float64 {
+	fx := s.devMap(g, cells, x)
+	v := randomPerturbation(rng, len(x)).ScaleBy(1 / attractor_eps)
+	xp := make(Vec, len(x))
+	jv := make(Vec, len(x))
+	lsum := 0.0
+	for it := range 2 * attractor_power_iter {
+		copy(xp, x)
+		xp.ScaleAcc(attractor_eps, v)
+		jv.Diff(s.devMap(g, cells, xp), fx)
+		r := jv.Norm2() / attractor_eps
+		if r == 0 {
+			return 0
+		}
+		copy(v, jv)
+		v.ScaleBy(1 / jv.Norm2())
+		if it >= attractor_power_iter {
+			lsum += math.Log(r)
+		}
+	}
+	return math.Exp(lsum / attractor_power_iter)
+}
+
+// Attractors of all individuals (under the cue of the population).
+func (pop *Population) Attractors(s *Setting, env Environment) []Attractor {
+	cue := pop.CueSource(s, env)
+	atts := make([]Attractor, len(pop.Indivs))
+	rngs := s.NewStreams(len(pop.Indivs))
+	s.ParallelFor(len(pop.Indivs), func(i int) {
+		atts[i] = pop.Indivs[i].Attractor(rngs[i], s, cue)
+	})
+	return atts
+}
+
+type AttractorStats struct {
+	Nfixed         int
+	Ncycle         int
+	Nchaotic       int
+	Ntransient     int
+	Period         float64 // mean period of cycles (NaN if none)
+	Lyapunov       float64 // mean largest Lyapunov exponent (NaN if no individuals)
+	SpectralRadius float64 // mean spectral radius at fixed points (NaN if none)
+}
+
+func GetAttractorStats(atts []Attractor) AttractorStats {
+	var stats AttractorStats
+	for _, att := range atts {
+		switch att.Kind {
+		case "Fixed":
+			stats.Nfixed++
+			stats.SpectralRadius += att.SpectralRadius
+		case "Cycle":
+			stats.Ncycle++
+			stats.Period += float64(att.Period)
+		case "Chaotic":
+			stats.Nchaotic++
+		default:
+			stats.Ntransient++
+		}
+		stats.Lyapunov += att.Lyapunov
+	}
+	mean := func(x float64, n int) float64 {
+		if n == 0 {
+			return math.NaN()
+		}
+		return x / float64(n)
+	}
+	stats.Lyapunov = mean(stats.Lyapunov, len(atts))
+	stats.SpectralRadius = mean(stats.SpectralRadius, stats.Nfixed)
+	stats.Period = mean(stats.Period, stats.Ncycle)
+	return stats
+}
+
+func (stats AttractorStats) Print(iepoch, igen int) {
+	fmt.Printf("%d\t%d\t%d\t%d\t%d\t%d\t%e\t%e\t%e\n",
+		iepoch, igen,
+		stats.Nfixed, stats.Ncycle, stats.Nchaotic, stats.Ntransient,
+		stats.Period, stats.Lyapunov, stats.SpectralRadius)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"os"
 )
 
@@ -13,7 +14,7 @@ const (
 	Top
 	Right
 	Bottom
-	NumFaces // Numbef of faces per cell
+	NumFaces // Number of faces per cell of a rectangular lattice
 )
 
 const (
@@ -25,36 +26,66 @@ const (
 	default_density       = 0.02 // genome matrix density
 	default_mutation_rate = 0.002
 	default_conv_develop  = 5e-6
-	default_len_block = 8    // env. change: elem per block
-	default_penv01    = 0.05 // prob of 0 -> 1 (deviation)
-	default_penv10    = 0.2  // prob of 1 -> 0 (reverse)
+	default_len_block     = 8    // env. change: elem per block
+	default_penv01        = 0.05 // prob of 0 -> 1 (deviation)
+	default_penv10        = 0.2  // prob of 1 -> 0 (reverse)
 
 	default_env_noise = 0.05
 
-	with_bias = false // bias in activation.
+	default_ndev_free = 50  // developmental steps without cost
+	default_ndev_cost = 0.1 // cost per extra developmental step
 )
 
 // various set-ups
 type Setting struct {
-	Basename      string // name of the model
-	Seed          uint64 // random seed
-	Outdir        string // output directory for trajectory
-	EnvFlip       bool   // learn plasticity
-	MaxPopulation int    // maximum population size
-	MaxGeneration int    // maximum number of generations per epoch
-	NumCellX      int    // number of cells in the x-axis
-	NumCellY      int    // number of cells in the y-axis
-	LenFace       int    // face length
-	ProductionRun bool   // true if production run (i.e. "test" phase)
-	LenBlock      int    // noise block length
-	Penv01        float64
-	Penv10        float64
-	MutRate       float64 // mutation rate
-	ConvDevelop   float64 // convergence limit
-	Denv          float64 // size of an environmental change
-	EnvNoise      float64
-
-	SelStrength   float64 // selection strength
+	Basename        string  // name of the model
+	Seed            uint64  // random seed
+	Outdir          string  // output directory for trajectory
+	EnvFlip         bool    // learn plasticity
+	EnvDynamics     string  // environmental change within an epoch (see envdyn.go)
+	EnvPeriod       int     // generations per cycle of Periodic dynamics
+	EnvCorr         float64 // lag-1 correlation of RedNoise dynamics
+	MaxPopulation   int     // maximum population size
+	NumWorkers      int     // number of worker goroutines (0: GOMAXPROCS)
+	MaxGeneration   int     // maximum number of generations per epoch
+	CheckpointEvery int     // generations between checkpoints (0: none)
+	NumCellX        int     // number of cells in the x-axis
+	NumCellY        int     // number of cells in the y-axis
+	Lattice         string  // arrangement of cells (see lattice.go)
+	SpatialEnv      bool    // environment for each boundary face of each cell (see spatial.go)
+	LenFace         int     // face length
+	ProductionRun   bool    // true if production run (i.e. "test" phase)
+	LenBlock        int     // noise block length
+	Penv01          float64
+	Penv10          float64
+	MutRate         float64 // mutation rate
+	ConvDevelop     float64 // convergence limit
+	Denv            float64 // size of an environmental change
+	EnvNoise        float64
+	ContinuousEnv   bool    // real-valued environments with Gaussian cue noise
+	CueSD           float64 // standard deviation of Gaussian cue noise
+	CueNoise        Vec     // cue noise of each face (nil: EnvNoise or CueSD; see cue.go)
+	CueRel          Vec     // correlation of the cue with the environment of each face (nil: 1)
+	CueLag          int     // cues from the environment of CueLag generations ago
+	DevCue          string  // cue schedule during development (see devcue.go)
+	DevCueStep      int     // step of a switch, or the start of a pulse or ramp
+	DevCueLen       int     // steps of a pulse or ramp, or between resampled cues
+	DevRecord       []int   // developmental steps at which the phenotype is recorded (ascending)
+	RecordDev       []int   // Ids of individuals whose developmental trajectories are saved with the dumps
+
+	SelStrength float64 // selection strength
+	Selection   string  // selection scheme (see select.go)
+	SelParam    float64 // parameter of the selection scheme (0: default)
+	NumElites   int     // number of the fittest carried over unchanged
+	Extinction  string  // what to do when all fitness is 0: "Drift" or "Abort"
+
+	FitnessFunc string  // fitness function: "Exponential" or "Gaussian"
+	SelFaces    Vec     // weights of the faces under selection (nil: Left only)
+	AlignMetric string  // alignment to environment: "Dot", "Corr" or "Hamming"
+	SelWidth    float64 // width of Gaussian stabilizing selection
+	PlastCost   float64 // cost of plasticity per cue-reading edge per cue element
+	NdevFree    int     // developmental steps without cost
+	NdevCost    float64 // cost per extra developmental step
 
 	WithCue    bool                 // with cue or not
 	MaxDevelop int                  // maximum number of developmental steps
@@ -63,6 +94,15 @@ type Setting struct {
 	LenLayer   []int                // Length of each state vector
 	Topology   SliceOfMaps[float64] // densities of genome matrices
 	Omega      Vec                  // scaling factors of activation functions
+	Activation []string             // activation function of each layer (see actfunc.go)
+
+	WithBias    bool    // bias in activation
+	BiasMutRate float64 // mutation rate of biases
+	BiasModel   string  // values of biases: "Ternary" (-1, 0, 1) or "Gaussian"
+	BiasSD      float64 // standard deviation of a Gaussian bias mutation
+
+	pcg *rand.PCG  // state of the master random number generator
+	rng *rand.Rand // master random number generator (see rand.go)
 }
 
 func GetDefaultSetting(modelname string) *Setting {
@@ -71,20 +111,36 @@ func GetDefaultSetting(modelname string) *Setting {
 		Outdir:        ".",
 		MaxPopulation: 500,
 		EnvFlip:       false,
+		EnvDynamics:   "",
+		EnvPeriod:     20,
+		EnvCorr:       0.9,
 		MaxGeneration: 200,
 		NumCellX:      default_num_cell_x,
 		NumCellY:      default_num_cell_y,
+		Lattice:       "Rect",
 		LenFace:       default_len_face,
 		ProductionRun: false,
 
-		LenBlock:      default_len_block,
-		Penv01:        default_penv01,
-		Penv10:        default_penv10,
-		MutRate:       default_mutation_rate,
-		ConvDevelop:   default_conv_develop,
-		Denv:          0.5,
-		EnvNoise:      default_env_noise,
-		SelStrength:   10.0,
+		LenBlock:    default_len_block,
+		Penv01:      default_penv01,
+		Penv10:      default_penv10,
+		MutRate:     default_mutation_rate,
+		ConvDevelop: default_conv_develop,
+		Denv:        0.5,
+		EnvNoise:    default_env_noise,
+		CueSD:       0.1,
+		SelStrength: 10.0,
+		Selection:   "Rejection",
+		Extinction:  ExtinctionDrift,
+		FitnessFunc: "Exponential",
+		AlignMetric: "Dot",
+		SelWidth:    0.5,
+		NdevFree:    default_ndev_free,
+		NdevCost:    default_ndev_cost,
+		WithBias:    false,
+		BiasMutRate: default_mutation_rate,
+		BiasModel:   "Ternary",
+		BiasSD:      0.5,
 
 		// parameters to be determined in SetModel are:
 		//WithCue
@@ -118,8 +174,15 @@ func LoadSetting(filename string) *Setting {
 	buffer, err := os.ReadFile(filename)
 	JustFail(err)
 	var s Setting
+	// not in older settings files
+	s.NdevFree = default_ndev_free
+	s.NdevCost = default_ndev_cost
 	err = json.Unmarshal(buffer, &s)
 	JustFail(err)
+	if s.Activation != nil && len(s.Activation) != s.NumLayers {
+		log.Fatalf("%s: %d activation functions for %d layers\n",
+			filename, len(s.Activation), s.NumLayers)
+	}
 
 	return &s
 }
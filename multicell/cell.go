@@ -3,30 +3,33 @@ package multicell
 import (
 	//	"fmt"
 	"log"
+	"math/rand/v2"
 	"slices"
 )
 
 type Cell struct {
-	Id     int           // Identifier within an individual
-	Facing [NumFaces]int // Facing Cell's Id; -1 if none.
-	Cue    []Vec         // points to neighboring cell face or environment
-	S      []Vec         // state vectors
+	Id     int   // Identifier within an individual
+	Facing []int // Facing Cell's Id; -1 if none.
+	Cue    []Vec // points to neighboring cell face or environment
+	S      []Vec // state vectors
 	Pave   Vec
 	Pvar   Vec
+	va     []Vec // scratch of DevStep (inputs of each layer)
 }
 
-func (s *Setting) NewCell(id int) Cell {
-	var facing [NumFaces]int
-	for i := range NumFaces {
+func (s *Setting) NewCell(rng *rand.Rand, id int) Cell {
+	nfaces := s.NumCellFaces()
+	facing := make([]int, nfaces)
+	for i := range nfaces {
 		facing[i] = -1
 	}
-	e := make([]Vec, NumFaces) //
+	e := make([]Vec, nfaces) //
 	pave := NewVec(s.LenLayer[s.NumLayers-1], 1.0)
 	pvar := NewVec(s.LenLayer[s.NumLayers-1], 0.0)
 
 	m := make([]Vec, s.NumLayers)
 	for i, nc := range s.LenLayer {
-		m[i] = NewVec(nc, 1.0).AddNoise(s.EnvNoise)
+		m[i] = NewVec(nc, 1.0).AddNoise(rng, s.EnvNoise)
 	}
 
 	return Cell{
@@ -38,6 +41,39 @@ func (s *Setting) NewCell(id int) Cell {
 		Pvar:   pvar}
 }
 
+// Reset c to s.NewCell(rng, id) in place (with the same random numbers).
+func (s *Setting) resetCell(rng *rand.Rand, c *Cell, id int) {
+	c.Id = id
+	for i := range c.Facing {
+		c.Facing[i] = -1
+	}
+	clear(c.Cue)
+	for l := range c.S {
+		c.S[l].SetAll(1.0)
+		c.S[l].flipNoise(rng, s.EnvNoise)
+	}
+	c.Pave.SetAll(1.0)
+	c.Pvar.SetAll(0.0)
+}
+
+// Whether cells can be reset to those of an individual with ncells cells.
+func (s *Setting) cellsFit(cells []Cell, ncells int) bool {
+	if len(cells) != ncells {
+		return false
+	}
+	for _, c := range cells {
+		if len(c.Facing) != s.NumCellFaces() || len(c.S) != s.NumLayers {
+			return false
+		}
+		for l, sl := range c.S {
+			if len(sl) != s.LenLayer[l] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (c *Cell) Initialize(s *Setting) {
 	for l := range s.NumLayers {
 		c.S[l].SetAll(1.0)
@@ -68,64 +104,48 @@ func (c *Cell) Bottom(s *Setting) Vec {
 }
 
 func (c *Cell) Face(s *Setting, iface int) Vec {
-	var v Vec
-	switch iface {
-	case Left:
-		v = c.Left(s)
-	case Top:
-		v = c.Top(s)
-	case Right:
-		v = c.Right(s)
-	case Bottom:
-		v = c.Bottom(s)
-	default:
+	if iface < 0 || iface >= len(c.Facing) {
 		log.Fatal("(*cell).Face: Unknown face")
 	}
-	return v
+	return c.S[s.NumLayers-1][iface*s.LenFace : (iface+1)*s.LenFace]
 }
 
 func (c *Cell) OppositeFace(s *Setting, iface int) Vec {
-	var v Vec
-	switch iface {
-	case Left:
-		v = c.Right(s)
-	case Top:
-		v = c.Bottom(s)
-	case Right:
-		v = c.Left(s)
-	case Bottom:
-		v = c.Top(s)
-	default:
-		log.Fatal("(*cell).OppositeFace: Unknown face")
-	}
-	return v
+	return c.Face(s, s.OppositeFace(iface))
 }
 
-func (c *Cell) DevStep(s *Setting, g Genome, istep int) float64 {
-	s.Topology.EachRow(func(l int, tl map[int]float64) {
-		va := make(Vec, s.LenLayer[l])
+func (c *Cell) DevStep(s *Setting, g DevGenome, istep int) float64 {
+	if len(c.va) != len(g.From) {
+		c.va = make([]Vec, len(g.From))
+		for l := range c.va {
+			c.va[l] = make(Vec, s.LenLayer[l])
+		}
+	}
+	out := c.S[s.NumLayers-1]
+	for l, from := range g.From {
+		va := c.va[l]
+		clear(va)
 		if l == 0 {
 			if s.WithCue {
-				s0 := slices.Concat(c.Cue...)
-				va.Diff(s0, c.S[s.NumLayers-1])
+				i := 0
+				for _, cue := range c.Cue {
+					va[i:].Diff(cue, out[i:])
+					i += len(cue)
+				}
 			} else {
-				copy(va, c.S[s.NumLayers-1])
+				copy(va, out)
 			}
 		}
-		for k := range tl {
-			va.MultSpMatVec(g.M[l][k], c.S[k]) // va is accumulated.
+		for n, k := range from {
+			va.MultCSRVec(g.M[l][n], c.S[k]) // va is accumulated.
 		}
-		if with_bias {
+		if s.WithBias {
 			va.Acc(g.B[l])
 		}
-		afunc := LCatan(s.Omega[l])
-		if l == s.NumLayers-1 {
-			afunc = CStep1(s.Omega[l])
-		}
-		c.S[l].ApplyFVec(afunc, va)
-	})
+		c.S[l].ApplyFVec(g.act[l], va)
+	}
 
-	for i, v := range c.S[s.NumLayers-1] {
+	for i, v := range out {
 		d := v - c.Pave[i]
 		incr := s.Alpha * d
 		c.Pave[i] += incr
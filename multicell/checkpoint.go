@@ -0,0 +1,88 @@
+package multicell
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// Everything needed to continue an epoch exactly where it stopped.
+type Checkpoint struct {
+	Setting Setting
+	Env     Environment // environment of the epoch (pop.Env is the current one)
+	Pop     Population  // population at the start of generation Pop.Igen
+	RNG     []byte      // state of the master random number generator
+}
+
+var interrupted atomic.Bool
+
+// On SIGINT or SIGTERM, Evolve saves a checkpoint at the next generation and exits.
+func CatchSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		log.Printf("Caught %v; stopping at the next generation\n", sig)
+		interrupted.Store(true)
+	}()
+}
+
+func (s *Setting) CheckpointFilename() string {
+	return fmt.Sprintf("%s/%s.ckpt.gz", s.Outdir, s.Basename)
+}
+
+// Save a checkpoint; the previous one is replaced only when this one is complete.
+func (pop *Population) SaveCheckpoint(s *Setting, env Environment) string {
+	cp := Checkpoint{
+		Setting: *s,
+		Env:     env,
+		Pop:     *pop,
+		RNG:     s.RandState()}
+
+	filename := s.CheckpointFilename()
+	tmpfile := filename + ".tmp"
+	fout, err := os.Create(tmpfile)
+	JustFail(err)
+	foutz, err := gzip.NewWriterLevel(fout, gzip.BestSpeed)
+	JustFail(err)
+	JustFail(gob.NewEncoder(foutz).Encode(cp))
+	JustFail(foutz.Close())
+	JustFail(fout.Close())
+	JustFail(os.Rename(tmpfile, filename))
+	log.Printf("Checkpoint (epoch %d, generation %d) saved in: %s\n",
+		pop.Iepoch, pop.Igen, filename)
+	return filename
+}
+
+// Load a checkpoint. The master random number generator of the returned
+// Setting is restored to the saved state.
+func LoadCheckpoint(filename string) (*Setting, Checkpoint) {
+	log.Printf("Load checkpoint from: %s\n", filename)
+	fin, err := os.Open(filename)
+	JustFail(err)
+	defer fin.Close()
+
+	finz, err := gzip.NewReader(fin)
+	JustFail(err)
+	defer finz.Close()
+
+	var cp Checkpoint
+	JustFail(gob.NewDecoder(finz).Decode(&cp))
+
+	s := cp.Setting
+	s.SetRandState(cp.RNG)
+	for i := range cp.Pop.Indivs {
+		s.SetCellInt(cp.Pop.Indivs[i].Cells)
+	}
+	return &s, cp
+}
+
+// Continue the epoch of a checkpoint.
+func (cp *Checkpoint) Resume(s *Setting) (Population, string) {
+	return cp.Pop.EvolveFrom(s, cp.Env)
+}
@@ -0,0 +1,115 @@
+package multicell
+
+/*
+	Cues.
+
+	The cue of a boundary face is, by default, the environment of the
+	face with noise (EnvNoise, or CueSD for real-valued environments).
+	Its reliability can be set separately from the selective environment:
+
+	CueLag:   cues come from the environment in effect CueLag generations ago
+	          (the oldest one available early in an epoch).
+	CueRel:   cues come from a predictor environment, drawn every generation,
+	          whose faces are correlated with the environment by CueRel
+	          (1: the environment, 0: uninformative, -1: misleading).
+	CueNoise: noise of each face, replacing EnvNoise (CueSD).
+*/
+
+import (
+	"log"
+	"math"
+	"math/rand/v2"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Face of each segment (of length LenFace) of an environment.
+// The result is shared and must not be modified.
+func (s *Setting) EnvSegmentFaces() []int {
+	return s.layout().segFaces
+}
+
+// Check the lengths of the per-face cue parameters.
+func (s *Setting) CheckCues() {
+	nf := s.NumCellFaces()
+	if s.CueRel != nil && len(s.CueRel) != nf {
+		log.Fatalf("CueRel: need %d values\n", nf)
+	}
+	for _, r := range s.CueRel {
+		if math.Abs(r) > 1 {
+			log.Fatalf("CueRel: %g not in [-1, 1]\n", r)
+		}
+	}
+	if s.CueNoise != nil && len(s.CueNoise) != nf {
+		log.Fatalf("CueNoise: need %d values\n", nf)
+	}
+}
+
+// Cue from env: sign flips (rate EnvNoise) or, for real-valued
+// environments, Gaussian noise (CueSD); per face with CueNoise.
+func (s *Setting) NoisyCue(rng *rand.Rand, env Environment) Environment {
+	if s.CueNoise == nil {
+		if s.ContinuousEnv {
+			return env.AddGaussNoise(rng, s.CueSD)
+		}
+		return env.AddNoise(rng, s.EnvNoise)
+	}
+	cue := make(Environment, 0, len(env))
+	for k, iface := range s.EnvSegmentFaces() {
+		seg := env[k*s.LenFace : (k+1)*s.LenFace]
+		if s.ContinuousEnv {
+			cue = append(cue, seg.AddGaussNoise(rng, s.CueNoise[iface])...)
+		} else {
+			cue = append(cue, seg.AddNoise(rng, s.CueNoise[iface])...)
+		}
+	}
+	return cue
+}
+
+// Predictor environment whose faces are correlated with those of env by CueRel:
+// each element is flipped with probability (1 - r)/2 or, for real-valued
+// environments, mixed with Gaussian noise of the same variance.
+func (s *Setting) PredictorEnv(rng *rand.Rand, env Environment) Environment {
+	pred := env.Clone()
+	for k, iface := range s.EnvSegmentFaces() {
+		r := s.CueRel[iface]
+		seg := pred[k*s.LenFace : (k+1)*s.LenFace]
+		if s.ContinuousEnv {
+			sd := math.Sqrt(stat.Variance(seg, nil))
+			for i, x := range seg {
+				seg[i] = r*x + math.Sqrt(1-r*r)*sd*rng.NormFloat64()
+			}
+		} else {
+			q := (1 - r) / 2
+			for i := range seg {
+				if rng.Float64() < q {
+					seg[i] *= -1
+				}
+			}
+		}
+	}
+	return pred
+}
+
+// Environment the cues come from (before noise) when env is in effect.
+func (pop *Population) CueSource(s *Setting, env Environment) Environment {
+	cue := env
+	if s.CueLag > 0 && len(pop.EnvHist) > 0 {
+		cue = pop.EnvHist[0]
+	}
+	if s.CueRel != nil {
+		cue = s.PredictorEnv(s.Rand(), cue)
+	}
+	return cue
+}
+
+// Remember the environment in effect for lagged cues.
+func (pop *Population) PushEnvHist(s *Setting) {
+	if s.CueLag <= 0 {
+		return
+	}
+	pop.EnvHist = append(pop.EnvHist, pop.Env)
+	if n := len(pop.EnvHist); n > s.CueLag {
+		pop.EnvHist = pop.EnvHist[n-s.CueLag:]
+	}
+}
@@ -0,0 +1,100 @@
+package multicell
+
+import (
+	"log"
+	"math/rand/v2"
+)
+
+/*
+	Cues changing during development (Setting.DevCue):
+
+	"Fixed" (or ""): the cue set before development.
+	"Switch":   the cue of the alternative environment from step DevCueStep on.
+	"Pulse":    the alternative for DevCueLen steps from step DevCueStep.
+	"Ramp":     a linear change to the alternative from step DevCueStep
+	            over DevCueLen steps.
+	"Resample": the cue noise redrawn every DevCueLen steps.
+
+	The alternative environment is AltEnv of the cue source. Development
+	does not stop at convergence before a switch, pulse or ramp is over.
+*/
+
+var devCueModes = []string{"Fixed", "Switch", "Pulse", "Ramp", "Resample"}
+
+// Alternative environment with a fraction Denv of the blocks of each
+// face flipped; the blocks are fixed by the seed and stream.
+func (s *Setting) AltEnv(env Environment, stream uint64) Environment {
+	return env.ChangeEnvBlock(s, rand.New(rand.NewPCG(s.Seed, stream)))
+}
+
+// Cue schedule of a developing individual.
+type DevCue struct {
+	src Environment // cue source (before noise)
+	cue Environment // noisy cue of src
+	alt Environment // noisy cue of the alternative environment
+}
+
+func CheckDevCue(mode string) {
+	for _, m := range devCueModes {
+		if mode == m || mode == "" {
+			return
+		}
+	}
+	log.Fatalf("Unknown developmental cue %s (one of %v)\n", mode, devCueModes)
+}
+
+// nil for fixed cues.
+func (s *Setting) NewDevCue(rng *rand.Rand, src, cue Environment) *DevCue {
+	switch s.DevCue {
+	case "", "Fixed":
+		return nil
+	case "Resample":
+		return &DevCue{src: src, cue: cue}
+	default:
+		CheckDevCue(s.DevCue)
+		return &DevCue{src: src, cue: cue, alt: s.NoisyCue(rng, s.AltEnv(src, 0))}
+	}
+}
+
+// Last step of the schedule before which development does not stop.
+func (dc *DevCue) Last(s *Setting) int {
+	switch s.DevCue {
+	case "Switch":
+		return s.DevCueStep
+	case "Pulse", "Ramp":
+		return s.DevCueStep + s.DevCueLen
+	}
+	return 0
+}
+
+// Cue at step istep; nil if unchanged from the previous step.
+func (dc *DevCue) At(s *Setting, rng *rand.Rand, istep int) Environment {
+	t0 := s.DevCueStep
+	n := max(1, s.DevCueLen)
+	switch s.DevCue {
+	case "Switch":
+		if istep == t0 {
+			return dc.alt
+		}
+	case "Pulse":
+		if istep == t0 {
+			return dc.alt
+		} else if istep == t0+n {
+			return dc.cue
+		}
+	case "Ramp":
+		if istep >= t0 && istep <= t0+n {
+			a := float64(istep-t0) / float64(n)
+			v := make(Environment, len(dc.cue))
+			for i, x := range dc.cue {
+				v[i] = (1-a)*x + a*dc.alt[i]
+			}
+			return v
+		}
+	case "Resample":
+		if istep > 0 && istep%n == 0 {
+			return s.NoisyCue(rng, dc.src)
+		}
+	}
+	return nil
+}
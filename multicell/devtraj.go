@@ -0,0 +1,150 @@
+package multicell
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// Recorder of a developmental trajectory: at every step (and before the
+// first one), the convergence metric (mean Pvar over cells; NaN initially)
+// followed by the state vectors of all layers of cell 0, cell 1, ...
+type DevRecorder struct {
+	NumCells int
+	LenLayer []int
+	Rows     []Vec
+}
+
+// Description of a saved trajectory (the .json file next to the .npy file).
+type DevTrajInfo struct {
+	Id       int
+	Iepoch   int
+	Igen     int
+	NumCells int
+	LenLayer []int
+	Columns  string
+	Ndev     int
+	Align    float64
+	Fitness  float64
+}
+
+// Develop the population individually, saving the trajectories of the
+// individuals with the Ids in s.RecordDev as those of DevelopRecord, in
+// <Outdir>/<Basename>_EE_GGG.dev<Id>.npy (and .json).
+func (pop *Population) developRecord(s *Setting, env, cue Environment, rngs []*rand.Rand) {
+	recs := make([]*DevRecorder, len(pop.Indivs))
+	for i, indiv := range pop.Indivs {
+		if slices.Contains(s.RecordDev, indiv.Id) {
+			recs[i] = s.NewDevRecorder(len(indiv.Cells))
+		}
+	}
+	s.ParallelFor(len(pop.Indivs), func(i int) {
+		pop.Indivs[i].develop(rngs[i], s, env, cue, recs[i])
+	})
+	for i, rec := range recs {
+		if rec != nil {
+			indiv := &pop.Indivs[i]
+			basename := s.TrajectoryFilename(pop.Iepoch, pop.Igen, fmt.Sprintf("dev%d", indiv.Id))
+			rec.Save(basename, indiv, pop.Iepoch, pop.Igen)
+		}
+	}
+}
+
+func (s *Setting) NewDevRecorder(ncells int) *DevRecorder {
+	return &DevRecorder{
+		NumCells: ncells,
+		LenLayer: s.LenLayer}
+}
+
+func (rec *DevRecorder) Record(indiv *Individual, dev float64) {
+	row := Vec{dev}
+	for _, c := range indiv.Cells {
+		for _, sl := range c.S {
+			row = append(row, sl...)
+		}
+	}
+	rec.Rows = append(rec.Rows, row)
+}
+
+// Save the trajectory in basename.npy and its description in basename.json.
+func (rec *DevRecorder) Save(basename string, indiv *Individual, iepoch, igen int) {
+	SaveNPY(basename+".npy", rec.Rows)
+	info := DevTrajInfo{
+		Id:       indiv.Id,
+		Iepoch:   iepoch,
+		Igen:     igen,
+		NumCells: rec.NumCells,
+		LenLayer: rec.LenLayer,
+		Columns:  "Pvar, then S[layer] of each layer of each cell",
+		Ndev:     indiv.Ndev,
+		Align:    indiv.Align,
+		Fitness:  indiv.Fitness}
+	json, err := json.MarshalIndent(info, "", "    ")
+	JustFail(err)
+	JustFail(os.WriteFile(basename+".json", json, 0644))
+	log.Printf("Developmental trajectory saved in: %s.npy\n", basename)
+}
+
+// Save rows of equal length as a 2-D float64 array in the NPY format (version 1.0).
+func SaveNPY(filename string, rows []Vec) {
+	ncol := 0
+	if len(rows) > 0 {
+		ncol = len(rows[0])
+	}
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%d, %d), }",
+		len(rows), ncol)
+	// magic (6) + version (2) + header length (2) + header + '\n' aligned to 64 bytes
+	pad := 63 - (10+len(header))%64
+	header += string(bytes.Repeat([]byte{' '}, pad)) + "\n"
+
+	var buf bytes.Buffer
+	buf.WriteString("\x93NUMPY\x01\x00")
+	JustFail(binary.Write(&buf, binary.LittleEndian, uint16(len(header))))
+	buf.WriteString(header)
+	for _, row := range rows {
+		if len(row) != ncol {
+			log.Fatalf("SaveNPY: rows of different lengths (%d and %d)\n", len(row), ncol)
+		}
+		JustFail(binary.Write(&buf, binary.LittleEndian, row))
+	}
+	JustFail(os.WriteFile(filename, buf.Bytes(), 0644))
+}
+
+var npyShape = regexp.MustCompile(`'shape': \((\d+), (\d+)\)`)
+
+// Load a 2-D float64 array saved by SaveNPY.
+func LoadNPY(filename string) []Vec {
+	buffer, err := os.ReadFile(filename)
+	JustFail(err)
+	if len(buffer) < 10 || string(buffer[:6]) != "\x93NUMPY" {
+		log.Fatalf("%s: not an NPY file\n", filename)
+	}
+	hlen := int(binary.LittleEndian.Uint16(buffer[8:10]))
+	m := npyShape.FindSubmatch(buffer[10 : 10+hlen])
+	if m == nil || !bytes.Contains(buffer[10:10+hlen], []byte("'<f8'")) {
+		log.Fatalf("%s: not a 2-D float64 array\n", filename)
+	}
+	nrow, _ := strconv.Atoi(string(m[1]))
+	ncol, _ := strconv.Atoi(string(m[2]))
+	data := buffer[10+hlen:]
+	if len(data) < 8*nrow*ncol {
+		log.Fatalf("%s: truncated\n", filename)
+	}
+	rows := make([]Vec, nrow)
+	for i := range rows {
+		rows[i] = make(Vec, ncol)
+		for j := range ncol {
+			k := 8 * (i*ncol + j)
+			rows[i][j] = math.Float64frombits(binary.LittleEndian.Uint64(data[k : k+8]))
+		}
+	}
+	return rows
+}
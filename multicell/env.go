@@ -1,17 +1,16 @@
 package multicell
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"gonum.org/v1/gonum/stat/distuv"
+	"io"
 	"log"
 	"math"
 	"math/rand/v2"
 	"os"
 )
 
-var rng = rand.New(rand.NewPCG(13, 97))
-
 type Environment = Vec
 
 type EnvironmentS []Environment
@@ -28,10 +27,10 @@ func (env Environment) Len() int {
 }
 
 func (s *Setting) NewEnvironment() Environment {
-	lenenv := s.LenFace * 4
+	lenenv := s.LenEnv()
 	env := make([]float64, lenenv)
 	for i := range lenenv {
-		if i < s.LenFace*2 {
+		if i < lenenv/2 {
 			env[i] = 1
 		} else {
 			env[i] = -1
@@ -57,51 +56,89 @@ func (env Environment) Bottom(s *Setting) Vec {
 }
 
 func (env Environment) Face(s *Setting, iface int) Vec {
-	var v Vec
-	switch iface {
-	case Left:
-		v = env.Left(s)
-	case Top:
-		v = env.Top(s)
-	case Right:
-		v = env.Right(s)
-	case Bottom:
-		v = env.Bottom(s)
-	default:
+	if iface < 0 || (iface+1)*s.LenFace > len(env) {
 		log.Fatal("(*env).Face: unknown face")
 	}
-
-	return v
+	return env[iface*s.LenFace : (iface+1)*s.LenFace]
 }
 
+// Half the L1 distance: the number of differing elements of +/-1 environments.
 func (env Environment) Compare(env0 Environment) float64 {
 	denv := make(Environment, len(env))
 	d := denv.Diff(env, env0).Norm1() / 2
 	return d
 }
 
+// Euclidean distance.
+func (env Environment) Distance(env0 Environment) float64 {
+	d2 := 0.0
+	for i, x := range env {
+		d := x - env0[i]
+		d2 += d * d
+	}
+	return math.Sqrt(d2)
+}
+
+// Compare for +/-1 environments, Distance for real-valued ones.
+func (s *Setting) EnvDistance(env, env0 Environment) float64 {
+	if s.ContinuousEnv {
+		return env.Distance(env0)
+	}
+	return env.Compare(env0)
+}
+
+// Real-valued environment, uniformly distributed in [-1, 1].
+func (s *Setting) NewContinuousEnvironment() Environment {
+	rng := s.Rand()
+	env := make(Environment, s.LenEnv())
+	for i := range env {
+		env[i] = 2*rng.Float64() - 1
+	}
+	return env
+}
+
+// Selecting environment of the Left faces; for a spatial environment,
+// those of all cells on the Left boundary (cf. SelectedPhenotype).
 func (env Environment) SelectingEnv(s *Setting) Vec {
-	return env.Left(s)
+	if !s.SpatialEnv {
+		return env.Left(s)
+	}
+	var v Vec
+	for _, benv := range s.BoundaryEnv(env) {
+		v = append(v, benv[Left]...)
+	}
+	return v
 }
 
-func (env Environment) AddNoise(p float64) Environment {
+func (env Environment) AddNoise(rng *rand.Rand, p float64) Environment {
 	cue := env.Clone()
-	dist := distuv.Poisson{Lambda: p * float64(len(cue))}
-	nflip := int(dist.Rand())
+	cue.flipNoise(rng, p)
+	return cue
+}
 
-	for _, i := range rand.Perm(len(cue))[:nflip] {
-		cue[i] *= -1
+// AddNoise in place.
+func (vec Vec) flipNoise(rng *rand.Rand, p float64) {
+	nflip := Poisson(rng, p*float64(len(vec)))
+
+	for _, i := range SampleDistinct(rng, len(vec), nflip) {
+		vec[i] *= -1
 	}
+}
 
+// Gaussian noise of standard deviation sd.
+func (env Environment) AddGaussNoise(rng *rand.Rand, sd float64) Environment {
+	cue := env.Clone()
+	for i := range cue {
+		cue[i] += sd * rng.NormFloat64()
+	}
 	return cue
 }
 
-func (env Environment) BlockNoise(s *Setting) Environment {
+func (env Environment) BlockNoise(rng *rand.Rand, s *Setting) Environment {
 	cue := env.Clone()
 	nblk := len(cue) / s.LenBlock
-	dist := distuv.Poisson{Lambda: s.EnvNoise * float64(nblk)}
-	nflip := int(dist.Rand())
-	for _, ib := range rand.Perm(nblk)[:nflip] {
+	nflip := Poisson(rng, s.EnvNoise*float64(nblk))
+	for _, ib := range SampleDistinct(rng, nblk, nflip) {
 		i := ib * s.LenBlock
 		for j := range s.LenBlock {
 			cue[i+j] *= -1
@@ -114,22 +151,22 @@ func (env Environment) ChangeEnv(s *Setting) Environment {
 	nflip := int(s.Denv * float64(s.LenFace))
 
 	nenv := env.Clone()
-	for iface := range NumFaces {
+	for iface := range len(env) / s.LenFace {
 		i := iface * s.LenFace
-		for _, p := range rng.Perm(s.LenFace)[:nflip] {
+		for _, p := range SampleDistinct(s.Rand(), s.LenFace, nflip) {
 			nenv[i+p] *= -1
 		}
 	}
 	return nenv
 }
 
-func (env Environment) ChangeEnvBlock(s *Setting) Environment {
+func (env Environment) ChangeEnvBlock(s *Setting, rng *rand.Rand) Environment {
 	nblk := s.LenFace / s.LenBlock
 	nflip := int(s.Denv * float64(nblk))
 	nenv := env.Clone()
-	for iface := range NumFaces {
+	for iface := range len(env) / s.LenFace {
 		i := iface * s.LenFace
-		for _, p := range rng.Perm(nblk)[:nflip] {
+		for _, p := range SampleDistinct(rng, nblk, nflip) {
 			j := i + p*s.LenBlock
 			for k := range s.LenBlock {
 				nenv[j+k] *= -1
@@ -141,15 +178,15 @@ func (env Environment) ChangeEnvBlock(s *Setting) Environment {
 
 func (env Environment) BlockFlip(s *Setting, ref Environment) Environment {
 	var nenv Environment
+	rng := s.Rand()
 	if rng.Float64() < math.Exp(-0.1) {
 		return env
 	}
 
 	nenv = ref.Clone()
 	nblk := len(env) / s.LenBlock
-	dist := distuv.Poisson{Lambda: float64(nblk) * s.Penv01}
-	nflip := int(dist.Rand())
-	for _, ib := range rand.Perm(nblk)[:nflip] {
+	nflip := Poisson(rng, float64(nblk)*s.Penv01)
+	for _, ib := range SampleDistinct(rng, nblk, nflip) {
 		i := ib * s.LenBlock
 		for j := range s.LenBlock {
 			nenv[i+j] *= -1
@@ -161,6 +198,7 @@ func (env Environment) BlockFlip(s *Setting, ref Environment) Environment {
 
 // less random block flip
 func (env Environment) BlockFlipNR(s *Setting, ref Environment) Environment {
+	rng := s.Rand()
 	if rng.Float64() < 0.5 {
 		return env
 	}
@@ -173,8 +211,8 @@ func (env Environment) BlockFlipNR(s *Setting, ref Environment) Environment {
 	} else {
 		nenv = env.Clone()
 	}
-	ib := rand.IntN(nflip) * s.LenBlock
-	for iface := range NumFaces {
+	ib := rng.IntN(nflip) * s.LenBlock
+	for iface := range len(env) / s.LenFace {
 		i := iface*s.LenFace + ib
 		for j := range s.LenBlock {
 			nenv[i+j] *= -1
@@ -185,6 +223,7 @@ func (env Environment) BlockFlipNR(s *Setting, ref Environment) Environment {
 }
 
 func (env Environment) MarkovFlip(s *Setting, ref Environment) Environment {
+	rng := s.Rand()
 	nenv := env.Clone()
 	nblk := len(env) / s.LenBlock
 	for ib := range nblk {
@@ -209,7 +248,7 @@ func (env Environment) GenerateEnvs(s *Setting, nepochs int) EnvironmentS {
 		if n == 0 {
 			continue
 		}
-		envs[n] = envs[n-1].ChangeEnvBlock(s)
+		envs[n] = envs[n-1].ChangeEnvBlock(s, s.Rand())
 
 	}
 	return envs
@@ -218,15 +257,20 @@ func (env Environment) GenerateEnvs(s *Setting, nepochs int) EnvironmentS {
 func (s *Setting) SaveEnvs(filename string, nepochs int) EnvironmentS {
 	env0 := s.NewEnvironment()
 	envs := env0.GenerateEnvs(s, nepochs)
-	envs.DumpEnvs(filename)
+	s.NewEnvFile("BlockWalk", 0, envs).Dump(filename)
 	return envs
 }
 
+// Bare JSON array (older format without a header).
 func (envs EnvironmentS) DumpEnvs(filename string) {
 	fout, err := os.Create(filename)
 	JustFail(err)
 	defer fout.Close()
+	envs.writeEnvs(fout)
+	fmt.Fprintf(fout, "\n")
+}
 
+func (envs EnvironmentS) writeEnvs(fout io.Writer) {
 	fmt.Fprintf(fout, "[")
 	for i, env := range envs {
 		json, err := json.Marshal(env)
@@ -236,14 +280,44 @@ func (envs EnvironmentS) DumpEnvs(filename string) {
 			fmt.Fprintf(fout, ",\n")
 		}
 	}
-	fmt.Fprintf(fout, "]\n")
+	fmt.Fprintf(fout, "]")
 }
 
+// Load environments from an environment file (EnvFile) or a bare array.
 func (s *Setting) LoadEnvs(filename string) []Environment {
-	var envs []Environment
+	return s.LoadEnvFile(filename).Envs
+}
+
+// Load an environment file; the header of a bare array is empty.
+func (s *Setting) LoadEnvFile(filename string) EnvFile {
+	var ef EnvFile
 	buffer, err := os.ReadFile(filename)
 	JustFail(err)
-	err = json.Unmarshal(buffer, &envs)
-	JustFail(err)
-	return envs
+	if b := bytes.TrimSpace(buffer); len(b) > 0 && b[0] == '[' {
+		err = json.Unmarshal(buffer, &ef.Envs)
+		JustFail(err)
+	} else {
+		err = json.Unmarshal(buffer, &ef)
+		JustFail(err)
+		if ef.Version > envfile_version {
+			log.Fatalf("%s: unsupported version %d\n", filename, ef.Version)
+		}
+		if ef.LenFace != s.LenFace {
+			log.Fatalf("%s: LenFace = %d; want %d\n", filename, ef.LenFace, s.LenFace)
+		}
+		if ef.ContinuousEnv != s.ContinuousEnv {
+			log.Printf("%s: ContinuousEnv = %t (Setting: %t)\n", filename, ef.ContinuousEnv, s.ContinuousEnv)
+		}
+		if ef.LenBlock != s.LenBlock {
+			log.Printf("%s: LenBlock = %d (Setting: %d)\n", filename, ef.LenBlock, s.LenBlock)
+		}
+	}
+	lenenv := s.LenEnv()
+	for i, env := range ef.Envs {
+		if len(env) != lenenv {
+			log.Fatalf("%s: environment %d has length %d; want %d (lattice %s)\n",
+				filename, i, len(env), lenenv, s.Lattice)
+		}
+	}
+	return ef
 }
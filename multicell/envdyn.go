@@ -0,0 +1,194 @@
+package multicell
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Change of the environment within an epoch.
+// Next returns the environment of generation pop.Igen+1 from the current
+// one (pop.Env) and the environment of the epoch (ref). A dynamics with
+// a hidden state keeps it in pop.EnvState, which is saved in checkpoints
+// and trajectories.
+type EnvDynamics interface {
+	Next(s *Setting, pop *Population, ref Environment) Environment
+}
+
+// Environmental dynamics by name (Setting.EnvDynamics).
+var envDynamics = map[string]EnvDynamics{
+	"Static":      StaticEnv{},
+	"BlockFlipNR": BlockFlipNREnv{},
+	"BlockFlip":   BlockFlipEnv{},
+	"Markov":      MarkovEnv{},
+	"Periodic":    PeriodicEnv{},
+	"RedNoise":    RedNoiseEnv{},
+}
+
+// Empty name: BlockFlipNR if EnvFlip, otherwise Static (older settings).
+func (s *Setting) GetEnvDynamics() EnvDynamics {
+	name := s.EnvDynamics
+	if name == "" {
+		if s.EnvFlip {
+			name = "BlockFlipNR"
+		} else {
+			name = "Static"
+		}
+	}
+	d, ok := envDynamics[name]
+	if !ok {
+		log.Fatal("Unknown environmental dynamics: " + name)
+	}
+	switch name {
+	case "BlockFlip":
+		if s.Penv01 < 0 || s.Penv01 > 1 {
+			log.Fatalf("BlockFlip: Penv01 = %g not in [0, 1]\n", s.Penv01)
+		}
+	case "Markov":
+		if s.Penv01 < 0 || s.Penv01 > 1 || s.Penv10 < 0 || s.Penv10 > 1 {
+			log.Fatalf("Markov: Penv01 = %g and Penv10 = %g; need values in [0, 1]\n",
+				s.Penv01, s.Penv10)
+		}
+	case "RedNoise":
+		if s.Penv01 < 0 || s.Penv10 < 0 || s.Penv01+s.Penv10 == 0 {
+			log.Fatalf("RedNoise: Penv01 = %g and Penv10 = %g; need non-negative values, not both 0\n",
+				s.Penv01, s.Penv10)
+		}
+		if math.Abs(s.EnvCorr) > 1 {
+			log.Fatalf("RedNoise: EnvCorr = %g not in [-1, 1]\n", s.EnvCorr)
+		}
+	}
+	return d
+}
+
+// The environment of the epoch throughout.
+type StaticEnv struct{}
+
+func (StaticEnv) Next(_ *Setting, _ *Population, ref Environment) Environment {
+	return ref
+}
+
+// With probability 1/2, one block (at the same position on every face)
+// is flipped from the environment of the epoch.
+type BlockFlipNREnv struct{}
+
+func (BlockFlipNREnv) Next(s *Setting, pop *Population, ref Environment) Environment {
+	return pop.Env.BlockFlipNR(s, ref)
+}
+
+// Occasionally, a Poisson number (mean Penv01 per block) of blocks
+// is flipped from the environment of the epoch.
+type BlockFlipEnv struct{}
+
+func (BlockFlipEnv) Next(s *Setting, pop *Population, ref Environment) Environment {
+	return pop.Env.BlockFlip(s, ref)
+}
+
+// Each block is a two-state Markov chain: it deviates from the
+// environment of the epoch with probability Penv01 and returns with Penv10.
+type MarkovEnv struct{}
+
+func (MarkovEnv) Next(s *Setting, pop *Population, ref Environment) Environment {
+	return pop.Env.MarkovFlip(s, ref)
+}
+
+// Seasons: the environment of the epoch for the first half of every
+// EnvPeriod generations, and an alternative one (AltEnv) for the second half.
+type PeriodicEnv struct{}
+
+func (PeriodicEnv) Next(s *Setting, pop *Population, ref Environment) Environment {
+	period := max(2, s.EnvPeriod)
+	if (pop.Igen+1)%period < period/2 {
+		return ref
+	}
+	return s.AltEnv(ref, uint64(pop.Iepoch))
+}
+
+// Red noise: each block has a latent AR(1) variable with lag-1
+// correlation EnvCorr and is flipped from the environment of the epoch
+// while it is above the threshold; the stationary fraction of flipped
+// blocks is Penv01/(Penv01+Penv10) as in MarkovEnv.
+type RedNoiseEnv struct{}
+
+func (RedNoiseEnv) Next(s *Setting, pop *Population, ref Environment) Environment {
+	rng := s.Rand()
+	nblk := len(ref) / s.LenBlock
+	x := pop.EnvState
+	if len(x) != nblk { // start from the stationary distribution
+		x = make(Vec, nblk)
+		for ib := range x {
+			x[ib] = rng.NormFloat64()
+		}
+	} else {
+		x = x.Clone()
+		r := s.EnvCorr
+		for ib := range x {
+			x[ib] = r*x[ib] + math.Sqrt(1-r*r)*rng.NormFloat64()
+		}
+	}
+	pop.EnvState = x
+
+	q := s.Penv01 / (s.Penv01 + s.Penv10)
+	thresh := distuv.UnitNormal.Quantile(1 - q)
+	nenv := ref.Clone()
+	for ib, xb := range x {
+		if xb > thresh {
+			i := ib * s.LenBlock
+			for j := range s.LenBlock {
+				nenv[i+j] *= -1
+			}
+		}
+	}
+	return nenv
+}
+
+func (s *Setting) EnvLogFilename(iepoch int) string {
+	return fmt.Sprintf("%s/%s_%2.2d.envlog", s.Outdir, s.Basename, iepoch)
+}
+
+// Log of the environments in effect: one line per generation with
+// the generation, the distance from the environment of the epoch
+// (EnvDistance), and the environment (JSON).
+// A resumed epoch is appended to the log after the lines of generation
+// pop.Igen and later (e.g. after a checkpoint) are dropped.
+func (pop *Population) OpenEnvLog(s *Setting) *os.File {
+	filename := s.EnvLogFilename(pop.Iepoch)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if pop.Igen == 0 {
+		flag |= os.O_TRUNC
+	} else {
+		truncateEnvLog(filename, pop.Igen)
+	}
+	fout, err := os.OpenFile(filename, flag, 0644)
+	JustFail(err)
+	return fout
+}
+
+// Cut the log at the first line of generation igen or later.
+func truncateEnvLog(filename string, igen int) {
+	buffer, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return
+	}
+	JustFail(err)
+	offset := 0
+	for _, line := range bytes.SplitAfter(buffer, []byte("\n")) {
+		var jgen int
+		if _, err := fmt.Sscan(string(line), &jgen); err == nil && jgen >= igen {
+			break
+		}
+		offset += len(line)
+	}
+	JustFail(os.Truncate(filename, int64(offset)))
+}
+
+func (pop *Population) LogEnv(s *Setting, fout *os.File, ref Environment) {
+	js, err := json.Marshal(pop.Env)
+	JustFail(err)
+	fmt.Fprintf(fout, "%d\t%g\t%s\n", pop.Igen, s.EnvDistance(pop.Env, ref), js)
+}
@@ -0,0 +1,194 @@
+package multicell
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/bits"
+	"os"
+)
+
+// Generators of a series of environments (one per epoch) from the
+// ancestral environment env0, which is always the first one.
+// param is generator-specific (see envGenerators).
+type EnvGenerator func(s *Setting, env0 Environment, n int, param float64) EnvironmentS
+
+// Environment generators by name.
+var envGenerators = map[string]EnvGenerator{
+	// random walk: a fraction Denv of blocks of each face flipped per epoch.
+	"BlockWalk": func(s *Setting, env0 Environment, n int, _ float64) EnvironmentS {
+		return env0.GenerateEnvs(s, n)
+	},
+	// a fraction Denv of blocks of each face flipped from the ancestor.
+	"Hamming": func(s *Setting, env0 Environment, n int, _ float64) EnvironmentS {
+		envs := make(EnvironmentS, n)
+		envs[0] = env0
+		for i := 1; i < n; i++ {
+			envs[i] = env0.ChangeEnvBlock(s, s.Rand())
+		}
+		return envs
+	},
+	// env0 and one novel environment (as in Hamming) in turn.
+	"Alternating": func(s *Setting, env0 Environment, n int, _ float64) EnvironmentS {
+		envs := make(EnvironmentS, n)
+		env1 := env0.ChangeEnvBlock(s, s.Rand())
+		for i := range envs {
+			if i%2 == 0 {
+				envs[i] = env0
+			} else {
+				envs[i] = env1
+			}
+		}
+		return envs
+	},
+	// returning to env0 after every novel environment (as in Hamming).
+	"Returning": func(s *Setting, env0 Environment, n int, _ float64) EnvironmentS {
+		envs := make(EnvironmentS, n)
+		for i := range envs {
+			if i%2 == 0 {
+				envs[i] = env0
+			} else {
+				envs[i] = env0.ChangeEnvBlock(s, s.Rand())
+			}
+		}
+		return envs
+	},
+	// real-valued random walk: Gaussian steps of standard deviation
+	// Denv, clipped to [-1, 1].
+	"GaussWalk": func(s *Setting, env0 Environment, n int, _ float64) EnvironmentS {
+		rng := s.Rand()
+		envs := make(EnvironmentS, n)
+		envs[0] = env0
+		for k := 1; k < n; k++ {
+			env := envs[k-1].Clone()
+			for i, x := range env {
+				env[i] = max(-1.0, min(1.0, x+s.Denv*rng.NormFloat64()))
+			}
+			envs[k] = env
+		}
+		return envs
+	},
+	"Orthogonal": orthogonalEnvs,
+	"Correlated": correlatedEnvs,
+}
+
+func GetEnvGenerator(name string) EnvGenerator {
+	gen, ok := envGenerators[name]
+	if !ok {
+		log.Fatal("Unknown environment generator: " + name)
+	}
+	return gen
+}
+
+// Mutually orthogonal environments: each face of env0 multiplied by
+// distinct rows of the Sylvester-Hadamard matrix of order LenFace
+// (a power of 2, >= n). Blocks are not respected.
+func orthogonalEnvs(s *Setting, env0 Environment, n int, _ float64) EnvironmentS {
+	m := s.LenFace
+	if bits.OnesCount(uint(m)) != 1 || n > m {
+		log.Fatalf("Orthogonal: need LenFace (%d) to be a power of 2 and >= %d\n", m, n)
+	}
+	rows := []int{0} // row 0 (all ones) gives env0.
+	for _, r := range s.Rand().Perm(m - 1)[:n-1] {
+		rows = append(rows, r+1)
+	}
+	envs := make(EnvironmentS, n)
+	for k, r := range rows {
+		env := env0.Clone()
+		for i := range env {
+			if bits.OnesCount(uint(r&(i%m)))%2 == 1 {
+				env[i] *= -1
+			}
+		}
+		envs[k] = env
+	}
+	return envs
+}
+
+// A family around env0 with the pairwise correlation param (expected)
+// among its members envs[1:]: every block is flipped from env0
+// independently with probability (1 - sqrt(param))/2. The ancestor
+// env0 (envs[0]) is not a member; its correlation with them is sqrt(param).
+func correlatedEnvs(s *Setting, env0 Environment, n int, param float64) EnvironmentS {
+	if param < 0 || param > 1 {
+		log.Fatalf("Correlated: correlation %f not in [0, 1]\n", param)
+	}
+	q := (1 - math.Sqrt(param)) / 2
+	rng := s.Rand()
+	nblk := len(env0) / s.LenBlock
+	envs := make(EnvironmentS, n)
+	envs[0] = env0
+	for k := 1; k < n; k++ {
+		env := env0.Clone()
+		for ib := range nblk {
+			if rng.Float64() < q {
+				i := ib * s.LenBlock
+				for j := range s.LenBlock {
+					env[i+j] *= -1
+				}
+			}
+		}
+		envs[k] = env
+	}
+	return envs
+}
+
+const envfile_version = 1
+
+// Self-describing environment file: the header and the environments
+// as a JSON object.
+type EnvFile struct {
+	EnvHeader
+	Envs EnvironmentS
+}
+
+type EnvHeader struct {
+	Version    int
+	Generator  string  // name of the generator
+	Param      float64 // parameter of the generator
+	Seed       uint64
+	Denv       float64
+	LenFace    int
+	LenBlock   int
+	Lattice    string
+	NumCellX   int
+	NumCellY   int
+	SpatialEnv bool
+	// real-valued (version 1 files without it are +/-1)
+	ContinuousEnv bool
+	// With genenv -replace, the first Replace environments are from
+	// an earlier file with the header Base.
+	Replace int        `json:",omitempty"`
+	Base    *EnvHeader `json:",omitempty"`
+}
+
+func (s *Setting) NewEnvFile(generator string, param float64, envs EnvironmentS) EnvFile {
+	return EnvFile{EnvHeader{
+		Version:    envfile_version,
+		Generator:  generator,
+		Param:      param,
+		Seed:       s.Seed,
+		Denv:       s.Denv,
+		LenFace:    s.LenFace,
+		LenBlock:   s.LenBlock,
+		Lattice:    s.Lattice,
+		NumCellX:   s.NumCellX,
+		NumCellY:   s.NumCellY,
+		SpatialEnv: s.SpatialEnv,
+
+		ContinuousEnv: s.ContinuousEnv}, envs}
+}
+
+// One environment per line as in the older bare array.
+func (ef EnvFile) Dump(filename string) {
+	fout, err := os.Create(filename)
+	JustFail(err)
+	defer fout.Close()
+
+	header, err := json.Marshal(ef.EnvHeader)
+	JustFail(err)
+	fmt.Fprintf(fout, "{%s,\n\"Envs\": ", header[1:len(header)-1])
+	ef.Envs.writeEnvs(fout)
+	fmt.Fprintf(fout, "}\n")
+}
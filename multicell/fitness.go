@@ -0,0 +1,202 @@
+package multicell
+
+import (
+	"log"
+	"math"
+)
+
+// Log-fitness of a converged individual (before costs) from indiv.Align
+// or its phenotype.
+type FitnessFunc interface {
+	LogFitness(s *Setting, indiv *Individual, env Environment) float64
+}
+
+// Fitness functions by name (Setting.FitnessFunc).
+var fitnessFuncs = map[string]FitnessFunc{
+	"Exponential": ExpFitness{},
+	"Gaussian":    GaussFitness{},
+}
+
+func (s *Setting) GetFitnessFunc() FitnessFunc {
+	name := s.FitnessFunc
+	if name == "" {
+		name = "Exponential"
+	}
+	f, ok := fitnessFuncs[name]
+	if !ok {
+		log.Fatal("Unknown fitness function: " + name)
+	}
+	return f
+}
+
+// exp(SelStrength * (Align - 1))
+type ExpFitness struct{}
+
+func (ExpFitness) LogFitness(s *Setting, indiv *Individual, _ Environment) float64 {
+	return s.SelStrength * (indiv.Align - 1)
+}
+
+// Gaussian stabilizing selection around the selecting environment:
+// exp(-d^2 / (2 SelWidth^2)), d^2 = mean squared deviation of the selected faces.
+type GaussFitness struct{}
+
+func (GaussFitness) LogFitness(s *Setting, indiv *Individual, env Environment) float64 {
+	d2 := 0.0
+	wtot := 0.0
+	s.EachSelectedFace(indiv, env, func(w float64, p, e Vec) {
+		for i, x := range p {
+			d := x - e[i]
+			d2 += w * d * d
+		}
+		wtot += w * float64(len(p))
+	})
+	if wtot == 0 { // no selected boundary face (e.g. on a torus)
+		return 0
+	}
+	d2 /= wtot
+	return -d2 / (2 * s.SelWidth * s.SelWidth)
+}
+
+// Check the weights of faces under selection (one non-negative weight
+// per face, not all zero) and the width of Gaussian selection.
+func (s *Setting) CheckSelection() {
+	if s.SelFaces != nil {
+		if len(s.SelFaces) != s.NumCellFaces() {
+			log.Fatalf("SelFaces: need %d values\n", s.NumCellFaces())
+		}
+		tot := 0.0
+		for _, w := range s.SelFaces {
+			if w < 0 {
+				log.Fatalf("SelFaces: negative weight %g\n", w)
+			}
+			tot += w
+		}
+		if tot == 0 {
+			log.Fatal("SelFaces: no face under selection")
+		}
+	}
+	if s.FitnessFunc == "Gaussian" && s.SelWidth <= 0 {
+		log.Fatalf("SelWidth: %g not positive\n", s.SelWidth)
+	}
+}
+
+// Weights of faces under selection; Left only by default.
+// The result is shared and must not be modified.
+func (s *Setting) SelFaceWeights() Vec {
+	if s.SelFaces != nil {
+		return s.SelFaces
+	}
+	return s.layout().selLeft
+}
+
+// Call f for every boundary face under selection with its weight,
+// phenotype, and (local) selecting environment.
+func (s *Setting) EachSelectedFace(indiv *Individual, env Environment, f func(w float64, p, e Vec)) {
+	for iface, w := range s.SelFaceWeights() {
+		if w == 0 {
+			continue
+		}
+		for i, c := range indiv.Cells {
+			if c.Facing[iface] < 0 {
+				f(w, c.Face(s, iface), s.boundarySegment(env, i, iface))
+			}
+		}
+	}
+}
+
+// Alignment of a phenotype p to an environment e
+// as the score and its normalization.
+func (s *Setting) alignFace(p, e Vec) (float64, float64) {
+	switch s.AlignMetric {
+	case "", "Dot":
+		return DotVecs(p, e), float64(len(p))
+	case "Hamming": // 1 - 2 * (fraction of mismatched signs)
+		nmis := 0
+		for i, x := range p {
+			if math.Signbit(x) != math.Signbit(e[i]) || (x == 0) != (e[i] == 0) {
+				nmis++
+			}
+		}
+		return float64(len(p) - 2*nmis), float64(len(p))
+	case "Corr":
+		return pearson(p, e), 1.0
+	case "MSD": // 1 - (mean squared deviation)/2; Dot for +/-1 values
+		d2 := 0.0
+		for i, x := range p {
+			d := x - e[i]
+			d2 += d * d
+		}
+		return float64(len(p)) - d2/2, float64(len(p))
+	default:
+		log.Fatal("Unknown alignment metric: " + s.AlignMetric)
+	}
+	return 0, 0
+}
+
+// Pearson's correlation coefficient of a phenotype v0 and a target v1.
+// Correlation is undefined for a constant target (e.g. the Left face of
+// NewEnvironment), so the cosine is used instead; it is 0 for a constant v0.
+func pearson(v0, v1 Vec) float64 {
+	m0 := v0.Mean()
+	m1 := v1.Mean()
+	var s00, s11, s01 float64
+	for i, x := range v0 {
+		d0 := x - m0
+		d1 := v1[i] - m1
+		s00 += d0 * d0
+		s11 += d1 * d1
+		s01 += d0 * d1
+	}
+	if s11 == 0 {
+		n0, n1 := math.Sqrt(DotVecs(v0, v0)), math.Sqrt(DotVecs(v1, v1))
+		if n0 == 0 || n1 == 0 {
+			return 0
+		}
+		return DotVecs(v0, v1) / (n0 * n1)
+	}
+	if s00 == 0 {
+		return 0
+	}
+	return s01 / math.Sqrt(s00*s11)
+}
+
+// Weighted alignment of the selected faces to the environment, in [-1, 1].
+func (s *Setting) Alignment(indiv *Individual, env Environment) float64 {
+	score := 0.0
+	norm := 0.0
+	s.EachSelectedFace(indiv, env, func(w float64, p, e Vec) {
+		a, n := s.alignFace(p, e)
+		score += w * a
+		norm += w * n
+	})
+	if norm == 0 { // no selected boundary face (e.g. on a torus)
+		return 0
+	}
+	return score / norm
+}
+
+// Number of edges reading the cue per cue element (0 without cue).
+func (s *Setting) CueSensitivity(g Genome) float64 {
+	if !s.WithCue {
+		return 0
+	}
+	n := 0
+	for l := range g.M {
+		if mat, ok := g.M[l][0]; ok {
+			mat.Do(func(_, _ int, _ float64) {
+				n++
+			})
+		}
+	}
+	return float64(n) / float64(s.LenLayer[0])
+}
+
+// Costs of development time and plasticity (subtracted from log fitness).
+func (s *Setting) FitnessCost(indiv *Individual) float64 {
+	nd := s.NdevCost * max(0.0, float64(indiv.Ndev-s.NdevFree))
+	pc := 0.0
+	if s.PlastCost > 0 {
+		pc = s.PlastCost * s.CueSensitivity(indiv.Genome)
+	}
+	return nd + pc
+}
@@ -1,5 +1,13 @@
 package multicell
 
+import (
+	"log"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
 /*
 		Genome is an array of maps of sparse matrices.
 	        g Genome
@@ -35,9 +43,9 @@ func (s *Setting) NewGenome() Genome {
 		B[l] = NewVec(nl, 0.0)
 	}
 	G := NewSliceOfMaps[SpMat](s.NumLayers)
-	s.Topology.Do(func(l, k int, density float64) {
+	s.Topology.DoOrdered(func(l, k int, density float64) {
 		G.M[l][k] = NewSpMat(s.LenLayer[l], s.LenLayer[k])
-		G.M[l][k].Randomize(density)
+		G.M[l][k].Randomize(s.Rand(), density)
 	})
 
 	return Genome{B, G}
@@ -45,10 +53,8 @@ func (s *Setting) NewGenome() Genome {
 
 func (genome Genome) Clone() Genome {
 	B := make([]Vec, len(genome.B))
-	if with_bias {
-		for l, bl := range genome.B {
-			B[l] = bl.Clone()
-		}
+	for l, bl := range genome.B {
+		B[l] = bl.Clone()
 	}
 	G := NewSliceOfMaps[SpMat](len(genome.M))
 	genome.Do(func(l, k int, mat SpMat) {
@@ -58,34 +64,88 @@ func (genome Genome) Clone() Genome {
 	return Genome{B, G}
 }
 
-func (genome Genome) Mutate(s *Setting) {
-	if with_bias {
+func (genome Genome) Mutate(rng *rand.Rand, s *Setting) {
+	if s.WithBias {
 		for l := range genome.B {
-			genome.B[l].Mutate(s.MutRate)
+			switch s.BiasModel {
+			case "", "Ternary":
+				genome.B[l].Mutate(rng, s.BiasMutRate)
+			case "Gaussian":
+				genome.B[l].MutateGauss(rng, s.BiasMutRate, s.BiasSD)
+			default:
+				log.Fatal("Unknown bias model: " + s.BiasModel)
+			}
 		}
 	}
-	s.Topology.Do(func(l, k int, density float64) {
-		genome.M[l][k].Mutate(s.MutRate, density)
+	s.Topology.DoOrdered(func(l, k int, density float64) {
+		genome.M[l][k].Mutate(rng, s.MutRate, density)
 	})
 }
 
-func (g0 Genome) MateWith(g1 Genome) (Genome, Genome) {
+func (g0 Genome) MateWith(rng *rand.Rand, s *Setting, g1 Genome) (Genome, Genome) {
 	B0 := make([]Vec, len(g0.B))
 	B1 := make([]Vec, len(g1.B))
-	if with_bias {
-		for l, b0 := range g0.B {
-			B0[l], B1[l] = b0.MateWith(g1.B[l])
+	for l, b0 := range g0.B {
+		if s.WithBias {
+			B0[l], B1[l] = b0.MateWith(rng, g1.B[l])
+		} else {
+			B0[l], B1[l] = b0.Clone(), g1.B[l].Clone()
 		}
 	}
 	M0 := NewSliceOfMaps[SpMat](len(g0.M))
 	M1 := NewSliceOfMaps[SpMat](len(g1.M))
-	g0.Do(func(l, k int, m0 SpMat) {
-		M0.M[l][k], M1.M[l][k] = m0.MateWith(g1.M[l][k])
+	g0.DoOrdered(func(l, k int, m0 SpMat) {
+		M0.M[l][k], M1.M[l][k] = m0.MateWith(rng, g1.M[l][k])
 	})
 
 	return Genome{B0, M0}, Genome{B1, M1}
 }
 
+// Genome frozen for development: the matrices in the CSR format.
+// The map-based Genome is for mutation and mating.
+type DevGenome struct {
+	B    []Vec
+	From [][]int    // From[l]: the layers to layer l in ascending order
+	M    [][]CSRMat // M[l][n]: the matrix from the layer From[l][n]
+	act  []func(float64) float64
+}
+
+func (g Genome) Compile(s *Setting) DevGenome {
+	var dg DevGenome
+	g.compileInto(s, &dg)
+	return dg
+}
+
+// Compile reusing the storage of dg.
+func (g Genome) compileInto(s *Setting, dg *DevGenome) {
+	dg.B = g.B
+	if len(dg.From) != s.NumLayers {
+		dg.From = make([][]int, s.NumLayers)
+		dg.M = make([][]CSRMat, s.NumLayers)
+		dg.act = make([]func(float64) float64, s.NumLayers)
+	}
+	for l := range dg.act {
+		dg.act[l] = s.GetActivation(l)
+	}
+	s.Topology.EachRow(func(l int, tl map[int]float64) {
+		dg.From[l] = dg.From[l][:0]
+		for _, k := range slices.Sorted(maps.Keys(tl)) {
+			n := len(dg.From[l])
+			dg.From[l] = append(dg.From[l], k)
+			if n == len(dg.M[l]) {
+				dg.M[l] = append(dg.M[l], CSRMat{})
+			}
+			g.M[l][k].toCSRInto(&dg.M[l][n])
+		}
+		dg.M[l] = dg.M[l][:len(dg.From[l])]
+	})
+}
+
+// Compiled genomes are reused across developments (see develop).
+var devGenomePool = sync.Pool{
+	New: func() any { return new(DevGenome) },
+}
+
 func (g Genome) ToVec(s *Setting) Vec {
 	var vec Vec
 	// Go's map is UNORDERED (random order for every "range").
@@ -95,7 +155,7 @@ func (g Genome) ToVec(s *Setting) Vec {
 				vec = append(vec, mat.ToVec()...)
 			}
 		}
-		if with_bias {
+		if s.WithBias {
 			vec = append(vec, g.B[l]...)
 		}
 	}
@@ -111,6 +171,11 @@ func (g0 Genome) Equal(g1 Genome) bool {
 			}
 		}
 	}
+	for l, b := range g0.B {
+		if !slices.Equal(b, g1.B[l]) {
+			return false
+		}
+	}
 
 	return true
 }
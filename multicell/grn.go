@@ -0,0 +1,221 @@
+package multicell
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+/*
+	Genomes as layered directed graphs (gene regulatory networks).
+
+	Node "L<l>F<f>_<i>" is unit i of layer l, in block f = i/LenFace
+	(the face for the input and output layers). An element M[l][k][i][j]
+	is an edge from unit j of layer k to unit i of layer l.
+
+	For a population, the consensus network has the edges present in at
+	least a fraction minfreq of the genomes; Weight is the mean value and
+	Freq the fraction of genomes with the edge.
+*/
+
+type GRNNode struct {
+	Id    string  `json:"id"`
+	Layer int     `json:"layer"`
+	Face  int     `json:"face"`
+	Index int     `json:"index"`
+	Bias  float64 `json:"bias"`
+}
+
+type GRNEdge struct {
+	Source string  `json:"source"`
+	Target string  `json:"target"`
+	Sign   int     `json:"sign"`
+	Weight float64 `json:"weight"`
+	Freq   float64 `json:"freq"`
+}
+
+// Node-link format (as in networkx).
+type GRN struct {
+	Directed   bool      `json:"directed"`
+	Multigraph bool      `json:"multigraph"`
+	Nodes      []GRNNode `json:"nodes"`
+	Edges      []GRNEdge `json:"links"`
+}
+
+func (s *Setting) grnNodeId(l, i int) string {
+	return fmt.Sprintf("L%dF%d_%d", l, i/s.LenFace, i)
+}
+
+func sign(x float64) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+// Network of a single genome.
+func (s *Setting) GenomeGRN(g Genome) GRN {
+	return s.ConsensusGRN([]Genome{g}, 1)
+}
+
+// Consensus network of genomes.
+func (s *Setting) ConsensusGRN(genomes []Genome, minfreq float64) GRN {
+	n := float64(len(genomes))
+	grn := GRN{Directed: true}
+	for l, nl := range s.LenLayer {
+		for i := range nl {
+			bias := 0.0
+			for _, g := range genomes {
+				if g.B != nil {
+					bias += g.B[l][i]
+				}
+			}
+			grn.Nodes = append(grn.Nodes, GRNNode{
+				Id:    s.grnNodeId(l, i),
+				Layer: l,
+				Face:  i / s.LenFace,
+				Index: i,
+				Bias:  bias / n})
+		}
+	}
+	s.Topology.DoOrdered(func(l, k int, _ float64) {
+		for i := range s.LenLayer[l] {
+			sum := make(map[int]float64)
+			count := make(map[int]int)
+			for _, g := range genomes {
+				for j, v := range g.M[l][k].M[i] {
+					sum[j] += v
+					count[j]++
+				}
+			}
+			for _, j := range slices.Sorted(maps.Keys(count)) {
+				freq := float64(count[j]) / n
+				if freq < minfreq {
+					continue
+				}
+				w := sum[j] / n
+				grn.Edges = append(grn.Edges, GRNEdge{
+					Source: s.grnNodeId(k, j),
+					Target: s.grnNodeId(l, i),
+					Sign:   sign(w),
+					Weight: w,
+					Freq:   freq})
+			}
+		}
+	})
+	return grn
+}
+
+func (grn GRN) WriteJSON(w io.Writer) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	JustFail(enc.Encode(grn))
+}
+
+func (grn GRN) WriteDOT(w io.Writer) {
+	fmt.Fprintf(w, "digraph GRN {\n")
+	fmt.Fprintf(w, "  rankdir=LR;\n")
+	layer := -1
+	for _, node := range grn.Nodes {
+		if node.Layer != layer {
+			if layer >= 0 {
+				fmt.Fprintf(w, "  }\n")
+			}
+			layer = node.Layer
+			fmt.Fprintf(w, "  subgraph layer%d {\n    rank=same;\n", layer)
+		}
+		fmt.Fprintf(w, "    %q [layer=%d, face=%d, bias=%g];\n",
+			node.Id, node.Layer, node.Face, node.Bias)
+	}
+	if layer >= 0 {
+		fmt.Fprintf(w, "  }\n")
+	}
+	for _, e := range grn.Edges {
+		color := "black"
+		switch e.Sign {
+		case 1:
+			color = "red"
+		case -1:
+			color = "blue"
+		}
+		// "weight" is a layout attribute (a non-negative integer) in Graphviz.
+		fmt.Fprintf(w, "  %q -> %q [sign=%d, w=%g, freq=%g, color=%s, penwidth=%.3g];\n",
+			e.Source, e.Target, e.Sign, e.Weight, e.Freq, color, 0.5+2.5*e.Freq)
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+type graphmlKey struct {
+	Id   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlNode struct {
+	Id   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphml struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphmlKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphmlNode `xml:"node"`
+		Edges       []graphmlEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+func (grn GRN) WriteGraphML(w io.Writer) {
+	doc := graphml{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphmlKey{
+			{"layer", "node", "layer", "int"},
+			{"face", "node", "face", "int"},
+			{"bias", "node", "bias", "double"},
+			{"sign", "edge", "sign", "int"},
+			{"weight", "edge", "weight", "double"},
+			{"freq", "edge", "freq", "double"}}}
+	doc.Graph.EdgeDefault = "directed"
+	for _, node := range grn.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphmlNode{
+			Id: node.Id,
+			Data: []graphmlData{
+				{"layer", fmt.Sprint(node.Layer)},
+				{"face", fmt.Sprint(node.Face)},
+				{"bias", fmt.Sprint(node.Bias)}}})
+	}
+	for _, e := range grn.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphmlEdge{
+			Source: e.Source,
+			Target: e.Target,
+			Data: []graphmlData{
+				{"sign", fmt.Sprint(e.Sign)},
+				{"weight", fmt.Sprint(e.Weight)},
+				{"freq", fmt.Sprint(e.Freq)}}})
+	}
+	fmt.Fprint(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	JustFail(enc.Encode(doc))
+	fmt.Fprintln(w)
+}
@@ -4,18 +4,20 @@ import (
 	//"log"
 	//	"fmt"
 	"math"
+	"math/rand/v2"
 	"slices"
 )
 
 type Individual struct {
-	Id      int
-	MomId   int
-	DadId   int
-	Genome  Genome
-	Cells   []Cell
-	Ndev    int
-	Align   float64
-	Fitness float64
+	Id       int
+	MomId    int
+	DadId    int
+	Genome   Genome
+	Cells    []Cell
+	Ndev     int
+	Align    float64
+	Fitness  float64
+	DevPheno []Vec // phenotypes at the developmental steps Setting.DevRecord
 }
 
 func (indiv *Individual) NumCells() int {
@@ -32,13 +34,18 @@ func (s *Setting) SetCellInt(cells []Cell) {
 	}
 }
 
-func (s *Setting) SetCellEnv(cells []Cell, env Environment) {
-	cue := env.AddNoise(s.EnvNoise)
-	//	cue := env.BlockNoise(s)
+func (s *Setting) SetCellEnv(rng *rand.Rand, cells []Cell, env Environment) {
+	cue := s.NoisyCue(rng, env)
+	//	cue := env.BlockNoise(rng, s)
+	s.SetCellCue(cells, cue)
+}
+
+// Set the cues of the boundary faces (without noise).
+func (s *Setting) SetCellCue(cells []Cell, cue Environment) {
 	for i, c := range cells {
 		for iface, iop := range c.Facing {
 			if iop < 0 {
-				cells[i].Cue[iface] = cue.Face(s, iface)
+				cells[i].Cue[iface] = s.boundarySegment(cue, i, iface)
 			}
 		}
 	}
@@ -69,26 +76,28 @@ func (s *Setting) CellId(i, j int) int {
 	return i*s.NumCellY + j
 }
 
-func (s *Setting) NewIndividual(id int, env Environment) Individual {
-	cells := make([]Cell, s.NumCellX*s.NumCellY)
-	for i := range s.NumCellX {
-		for j := range s.NumCellY {
-			id := s.CellId(i, j)
-			cells[id] = s.NewCell(id)
-			if i > 0 {
-				cells[id].Facing[Left] = s.CellId(i-1, j)
-			}
-			if i < s.NumCellX-1 {
-				cells[id].Facing[Right] = s.CellId(i+1, j)
-			}
-			if j > 0 {
-				cells[id].Facing[Bottom] = s.CellId(i, j-1)
-			}
-			if j < s.NumCellY-1 {
-				cells[id].Facing[Top] = s.CellId(i, j+1)
-			}
+func (s *Setting) NewIndividual(rng *rand.Rand, id int, env Environment) Individual {
+	return s.RenewIndividual(rng, id, env, nil)
+}
+
+// Same as NewIndividual, but the cells (old) of a discarded individual
+// are reused if they fit.
+func (s *Setting) RenewIndividual(rng *rand.Rand, id int, env Environment, old []Cell) Individual {
+	facing := s.LatticeFacing()
+	cells := old
+	if s.cellsFit(cells, len(facing)) {
+		for id := range cells {
+			s.resetCell(rng, &cells[id], id)
+		}
+	} else {
+		cells = make([]Cell, len(facing))
+		for id := range cells {
+			cells[id] = s.NewCell(rng, id)
 		}
 	}
+	for id := range cells {
+		copy(cells[id].Facing, facing[id])
+	}
 
 	s.SetCellInt(cells)
 
@@ -104,7 +113,7 @@ func (s *Setting) NewIndividual(id int, env Environment) Individual {
 }
 
 func (indiv *Individual) Clone(s *Setting, env Environment) Individual {
-	kid := s.NewIndividual(indiv.Id, env)
+	kid := s.NewIndividual(s.Rand(), indiv.Id, env)
 	kid.Genome = indiv.Genome.Clone()
 	return kid
 }
@@ -165,54 +174,98 @@ func (indiv *Individual) Initialize(s *Setting, env Environment) {
 }
 
 func (indiv *Individual) SetFitness(s *Setting, env Environment, conv float64) {
-	selenv := env.SelectingEnv(s)
-	selphen := indiv.SelectedPhenotype(s)
-	ali := 0.0
-	for _, p := range selphen {
-		ali += DotVecs(p, selenv)
-	}
-	indiv.Align = ali / float64(s.LenFace*len(selphen))
+	indiv.Align = s.Alignment(indiv, env)
 	if conv >= s.ConvDevelop && s.MaxDevelop > 1 {
 		indiv.Fitness = 0.0
 	} else {
-		mm := s.SelStrength * (indiv.Align - 1)
-		nd := 0.1 * max(0.0, float64(indiv.Ndev-50))
-		indiv.Fitness = math.Exp(mm - nd)
+		lf := s.GetFitnessFunc().LogFitness(s, indiv, env)
+		indiv.Fitness = math.Exp(lf - s.FitnessCost(indiv))
 	}
 }
 
-func (indiv *Individual) Develop(s *Setting, env Environment) Individual {
-	s.SetCellEnv(indiv.Cells, env)
+func (indiv *Individual) Develop(rng *rand.Rand, s *Setting, env Environment) Individual {
+	return indiv.DevelopCue(rng, s, env, env)
+}
+
+// Develop with cues from cue (before noise) under selection by env.
+// The cue may change during development (see devcue.go).
+func (indiv *Individual) DevelopCue(rng *rand.Rand, s *Setting, env, cue Environment) Individual {
+	return indiv.develop(rng, s, env, cue, nil)
+}
+
+// Develop recording the trajectory in rec.
+func (indiv *Individual) DevelopRecord(rng *rand.Rand, s *Setting, env Environment, rec *DevRecorder) Individual {
+	return indiv.develop(rng, s, env, env, rec)
+}
+
+func (indiv *Individual) develop(rng *rand.Rand, s *Setting, env, cue Environment, rec *DevRecorder) Individual {
+	noisy := s.NoisyCue(rng, cue)
+	s.SetCellCue(indiv.Cells, noisy)
+	if rec != nil {
+		rec.Record(indiv, math.NaN())
+	}
+	dc := s.NewDevCue(rng, cue, noisy)
+	last := 0
+	if dc != nil {
+		last = dc.Last(s)
+	}
+	indiv.DevPheno = nil
+	dg := devGenomePool.Get().(*DevGenome)
+	defer devGenomePool.Put(dg)
+	indiv.Genome.compileInto(s, dg)
 	dev := 0.0
 	for istep := range s.MaxDevelop {
+		if dc != nil {
+			if c := dc.At(s, rng, istep); c != nil {
+				s.SetCellCue(indiv.Cells, c)
+			}
+		}
 		dev = 0.0
 		for i := range indiv.Cells {
-			dev += indiv.Cells[i].DevStep(s, indiv.Genome, istep)
+			dev += indiv.Cells[i].DevStep(s, *dg, istep)
 		}
 		indiv.Ndev = istep + 1
+		indiv.recordPheno(s, indiv.Ndev)
 		dev /= float64(len(indiv.Cells))
-		if dev < s.ConvDevelop {
+		if rec != nil {
+			rec.Record(indiv, dev)
+		}
+		if dev < s.ConvDevelop && istep >= last {
 			break
 		}
 	}
+	indiv.recordPheno(s, s.MaxDevelop)
 	indiv.SetFitness(s, env, dev)
 	return *indiv
 }
 
-func (s *Setting) MateIndividuals(indiv0, indiv1 Individual, env Environment) (Individual, Individual) {
-	g0, g1 := indiv0.Genome.MateWith(indiv1.Genome)
-	kid0 := s.NewIndividual(-1, env)
-	kid1 := s.NewIndividual(-2, env)
+// Record the phenotype at the developmental steps DevRecord up to ndev
+// (after convergence, the final phenotype for the later steps).
+func (indiv *Individual) recordPheno(s *Setting, ndev int) {
+	for len(indiv.DevPheno) < len(s.DevRecord) && s.DevRecord[len(indiv.DevPheno)] <= ndev {
+		indiv.DevPheno = append(indiv.DevPheno, indiv.PhenotypeVec(s))
+	}
+}
+
+func (s *Setting) MateIndividuals(rng *rand.Rand, indiv0, indiv1 Individual, env Environment) (Individual, Individual) {
+	return s.MateIndividualsInto(rng, indiv0, indiv1, env, nil, nil)
+}
+
+// Same as MateIndividuals, with the kids in the cells old0 and old1 if they fit.
+func (s *Setting) MateIndividualsInto(rng *rand.Rand, indiv0, indiv1 Individual, env Environment, old0, old1 []Cell) (Individual, Individual) {
+	g0, g1 := indiv0.Genome.MateWith(rng, s, indiv1.Genome)
+	kid0 := s.RenewIndividual(rng, -1, env, old0)
+	kid1 := s.RenewIndividual(rng, -2, env, old1)
 
 	kid0.MomId = indiv0.Id
 	kid0.DadId = indiv1.Id
 	kid0.Genome = g0
-	kid0.Genome.Mutate(s)
+	kid0.Genome.Mutate(rng, s)
 
-	kid0.MomId = indiv1.Id
-	kid0.DadId = indiv0.Id
+	kid1.MomId = indiv1.Id
+	kid1.DadId = indiv0.Id
 	kid1.Genome = g1
-	kid1.Genome.Mutate(s)
+	kid1.Genome.Mutate(rng, s)
 
 	return kid0, kid1
 }
@@ -0,0 +1,185 @@
+package multicell
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"slices"
+)
+
+/*
+	In-silico knockouts of genome elements:
+
+	"Row":  row I of M[L][K] (the inputs of unit I of layer L from layer K).
+	"Col":  column J of M[L][K] (the outputs of unit J of layer K to layer L).
+	"Edge": the element (I, J) of M[L][K].
+	"Link": the whole matrix M[L][K].
+
+	Each individual is developed without cue noise with the intact and
+	the knocked-out genome, and the changes of Align, Ndev, the phenotype
+	and the fitness are averaged over the population.
+*/
+
+var knockoutKinds = []string{"Row", "Col", "Edge", "Link"}
+
+type Knockout struct {
+	Kind string
+	L, K int // matrix M[L][K]
+	I, J int // row and column (-1 if not applicable)
+}
+
+func (ko Knockout) String() string {
+	switch ko.Kind {
+	case "Row":
+		return fmt.Sprintf("Row:%d<%d:%d", ko.L, ko.K, ko.I)
+	case "Col":
+		return fmt.Sprintf("Col:%d<%d:%d", ko.L, ko.K, ko.J)
+	case "Edge":
+		return fmt.Sprintf("Edge:%d<%d:%d,%d", ko.L, ko.K, ko.I, ko.J)
+	}
+	return fmt.Sprintf("Link:%d<%d", ko.L, ko.K)
+}
+
+// All knockouts of a kind. Edges are the nonzero elements of any of the genomes.
+func (s *Setting) GetKnockouts(kind string, genomes []Genome) []Knockout {
+	var kos []Knockout
+	s.Topology.DoOrdered(func(l, k int, _ float64) {
+		switch kind {
+		case "Row":
+			for i := range s.LenLayer[l] {
+				kos = append(kos, Knockout{kind, l, k, i, -1})
+			}
+		case "Col":
+			for j := range s.LenLayer[k] {
+				kos = append(kos, Knockout{kind, l, k, -1, j})
+			}
+		case "Edge":
+			for i := range s.LenLayer[l] {
+				js := make(map[int]bool)
+				for _, g := range genomes {
+					for j := range g.M[l][k].M[i] {
+						js[j] = true
+					}
+				}
+				for _, j := range slices.Sorted(maps.Keys(js)) {
+					kos = append(kos, Knockout{kind, l, k, i, j})
+				}
+			}
+		case "Link":
+			kos = append(kos, Knockout{kind, l, k, -1, -1})
+		default:
+			log.Fatalf("Unknown knockout %s (one of %v)\n", kind, knockoutKinds)
+		}
+	})
+	return kos
+}
+
+// Copy of g with the element knocked out; only the affected matrix is copied.
+func (ko Knockout) Apply(g Genome) Genome {
+	G := NewSliceOfMaps[SpMat](len(g.M))
+	g.Do(func(l, k int, mat SpMat) {
+		G.M[l][k] = mat
+	})
+	src := g.M[ko.L][ko.K]
+	mat := src.Clone()
+	switch ko.Kind {
+	case "Row":
+		clear(mat.M[ko.I])
+	case "Col":
+		for _, mi := range mat.M {
+			delete(mi, ko.J)
+		}
+	case "Edge":
+		delete(mat.M[ko.I], ko.J)
+	case "Link":
+		mat = NewSpMat(mat.Nrows(), mat.Ncols())
+	}
+	G.M[ko.L][ko.K] = mat
+	return Genome{g.B, G}
+}
+
+type KnockoutEffect struct {
+	Knockout
+	Align        float64 // mean change of Align
+	Ndev         float64 // mean change of Ndev
+	Pheno        float64 // mean RMS change of the phenotype
+	Essentiality float64 // relative loss of mean fitness
+}
+
+// Develop g without cue noise; the result does not depend on stream.
+func (s *Setting) developNoiseless(id int, g Genome, env Environment, stream uint64) Individual {
+	sq := s.noiseless()
+	rng := rand.New(rand.NewPCG(s.Seed, stream))
+	kid := sq.NewIndividual(rng, id, env)
+	kid.Genome = g
+	kid.Develop(rng, sq, env)
+	return kid
+}
+
+// Effects of the knockouts, sorted by essentiality (in descending order).
+func (pop *Population) KnockoutEffects(s *Setting, env Environment, kos []Knockout) []KnockoutEffect {
+	n := len(pop.Indivs)
+	wt := make([]Individual, n)
+	wpheno := make([]Vec, n)
+	s.ParallelFor(n, func(i int) {
+		wt[i] = s.developNoiseless(i, pop.Indivs[i].Genome, env, uint64(i))
+		wpheno[i] = wt[i].PhenotypeVec(s)
+	})
+
+	// per knockout and individual: changes of Align, Ndev and the phenotype; fitness
+	type result struct{ align, ndev, pheno, fitness float64 }
+	res := make([]result, len(kos)*n)
+	s.ParallelFor(len(res), func(m int) {
+		ko, i := kos[m/n], m%n
+		kid := s.developNoiseless(i, ko.Apply(pop.Indivs[i].Genome), env, uint64(i))
+		res[m] = result{
+			align:   kid.Align - wt[i].Align,
+			ndev:    float64(kid.Ndev - wt[i].Ndev),
+			pheno:   rmsDiff(kid.PhenotypeVec(s), wpheno[i]),
+			fitness: kid.Fitness}
+	})
+
+	wfit := 0.0
+	for _, w := range wt {
+		wfit += w.Fitness
+	}
+	effs := make([]KnockoutEffect, len(kos))
+	for e, ko := range kos {
+		eff := KnockoutEffect{Knockout: ko}
+		kfit := 0.0
+		for _, r := range res[e*n : (e+1)*n] {
+			eff.Align += r.align
+			eff.Ndev += r.ndev
+			eff.Pheno += r.pheno
+			kfit += r.fitness
+		}
+		eff.Align /= float64(n)
+		eff.Ndev /= float64(n)
+		eff.Pheno /= float64(n)
+		if wfit > 0 {
+			eff.Essentiality = 1 - kfit/wfit
+		}
+		effs[e] = eff
+	}
+	slices.SortStableFunc(effs, func(a, b KnockoutEffect) int {
+		switch {
+		case a.Essentiality > b.Essentiality:
+			return -1
+		case a.Essentiality < b.Essentiality:
+			return 1
+		}
+		return 0
+	})
+	return effs
+}
+
+func PrintKnockoutEffects(fout io.Writer, label string, effs []KnockoutEffect) {
+	fmt.Fprintf(fout, "#%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		"Env", "Rank", "Element", "Essentiality", "dAlign", "dNdev", "dPheno")
+	for rank, eff := range effs {
+		fmt.Fprintf(fout, "%s\t%d\t%s\t%e\t%e\t%e\t%e\n",
+			label, rank+1, eff.Knockout, eff.Essentiality, eff.Align, eff.Ndev, eff.Pheno)
+	}
+}
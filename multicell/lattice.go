@@ -0,0 +1,179 @@
+package multicell
+
+import (
+	"log"
+	"sync"
+)
+
+// faces of a hexagonal cell, clockwise from Left as the rectangular ones.
+const (
+	HexLeft = iota
+	HexUpperLeft
+	HexUpperRight
+	HexRight
+	HexLowerRight
+	HexLowerLeft
+	NumHexFaces
+)
+
+// Arrangement of the cells of an individual on a NumCellX x NumCellY grid.
+// Faces are numbered clockwise so that the opposite of face i is
+// (i + NumFaces/2) mod NumFaces.
+type Lattice interface {
+	NumFaces() int
+	// Facing cell Id of each face of cell (i, j); -1 for the boundary.
+	Neighbors(s *Setting, i, j int) []int
+}
+
+// Lattices by name (Setting.Lattice).
+var lattices = map[string]Lattice{
+	"Rect":     RectLattice{},
+	"Torus":    RectLattice{Periodic: true},
+	"Hex":      HexLattice{},
+	"HexTorus": HexLattice{Periodic: true},
+}
+
+func (s *Setting) GetLattice() Lattice {
+	name := s.Lattice
+	if name == "" {
+		name = "Rect"
+	}
+	lat, ok := lattices[name]
+	if !ok {
+		log.Fatal("Unknown lattice: " + name)
+	}
+	return lat
+}
+
+// Number of faces per cell.
+func (s *Setting) NumCellFaces() int {
+	return s.GetLattice().NumFaces()
+}
+
+func (s *Setting) OppositeFace(iface int) int {
+	nf := s.NumCellFaces()
+	return (iface + nf/2) % nf
+}
+
+// Facing cell Ids of the faces of all cells (by cell Id).
+// The result is shared (see cellLayout) and must not be modified.
+func (s *Setting) LatticeFacing() [][]int {
+	return s.layout().facing
+}
+
+// Arrangement of the cells and of the boundary segments of environments,
+// computed once for each configuration and shared by all individuals.
+type cellLayout struct {
+	facing   [][]int // LatticeFacing
+	boundary [][]int // offset in env of each (cell Id, face) on the boundary; -1 if facing a cell
+	segFaces []int   // EnvSegmentFaces
+	selLeft  Vec     // default SelFaceWeights (Left only)
+}
+
+type layoutKey struct {
+	lattice string
+	ncellx  int
+	ncelly  int
+	lenface int
+	spatial bool
+}
+
+var layouts sync.Map // layoutKey -> *cellLayout
+
+func (s *Setting) layout() *cellLayout {
+	key := layoutKey{s.Lattice, s.NumCellX, s.NumCellY, s.LenFace, s.SpatialEnv}
+	if l, ok := layouts.Load(key); ok {
+		return l.(*cellLayout)
+	}
+	l, _ := layouts.LoadOrStore(key, s.newLayout())
+	return l.(*cellLayout)
+}
+
+func (s *Setting) newLayout() *cellLayout {
+	lattice := s.GetLattice()
+	l := &cellLayout{
+		facing:  make([][]int, s.NumCellX*s.NumCellY),
+		selLeft: NewVec(lattice.NumFaces(), 0.0)}
+	l.selLeft[Left] = 1.0
+	for i := range s.NumCellX {
+		for j := range s.NumCellY {
+			l.facing[s.CellId(i, j)] = lattice.Neighbors(s, i, j)
+		}
+	}
+	if !s.SpatialEnv {
+		for iface := range lattice.NumFaces() {
+			l.segFaces = append(l.segFaces, iface)
+		}
+	}
+	l.boundary = make([][]int, len(l.facing))
+	for id, fc := range l.facing {
+		l.boundary[id] = make([]int, len(fc))
+		for iface, iop := range fc {
+			switch {
+			case iop >= 0:
+				l.boundary[id][iface] = -1
+			case s.SpatialEnv:
+				l.boundary[id][iface] = len(l.segFaces) * s.LenFace
+				l.segFaces = append(l.segFaces, iface)
+			default:
+				l.boundary[id][iface] = iface * s.LenFace
+			}
+		}
+	}
+	return l
+}
+
+// Id of cell (i, j); out of the grid, -1 or wrapped around if periodic.
+func (s *Setting) latticeCell(periodic bool, i, j int) int {
+	if periodic {
+		i = (i%s.NumCellX + s.NumCellX) % s.NumCellX
+		j = (j%s.NumCellY + s.NumCellY) % s.NumCellY
+	} else if i < 0 || i >= s.NumCellX || j < 0 || j >= s.NumCellY {
+		return -1
+	}
+	return s.CellId(i, j)
+}
+
+// Square cells; the y-axis goes from Bottom to Top.
+// A periodic lattice with a single row (column) connects a cell to itself.
+type RectLattice struct {
+	Periodic bool
+}
+
+func (RectLattice) NumFaces() int {
+	return NumFaces
+}
+
+func (lat RectLattice) Neighbors(s *Setting, i, j int) []int {
+	nb := make([]int, NumFaces)
+	nb[Left] = s.latticeCell(lat.Periodic, i-1, j)
+	nb[Top] = s.latticeCell(lat.Periodic, i, j+1)
+	nb[Right] = s.latticeCell(lat.Periodic, i+1, j)
+	nb[Bottom] = s.latticeCell(lat.Periodic, i, j-1)
+	return nb
+}
+
+// Hexagonal cells in rows along the x-axis; odd rows are shifted by half
+// a cell to the right. A periodic lattice needs an even NumCellY.
+type HexLattice struct {
+	Periodic bool
+}
+
+func (HexLattice) NumFaces() int {
+	return NumHexFaces
+}
+
+func (lat HexLattice) Neighbors(s *Setting, i, j int) []int {
+	if lat.Periodic && s.NumCellY%2 != 0 {
+		log.Fatalf("HexTorus: NumCellY (%d) must be even\n", s.NumCellY)
+	}
+	d := j % 2
+	nb := make([]int, NumHexFaces)
+	nb[HexLeft] = s.latticeCell(lat.Periodic, i-1, j)
+	nb[HexUpperLeft] = s.latticeCell(lat.Periodic, i-1+d, j+1)
+	nb[HexUpperRight] = s.latticeCell(lat.Periodic, i+d, j+1)
+	nb[HexRight] = s.latticeCell(lat.Periodic, i+1, j)
+	nb[HexLowerRight] = s.latticeCell(lat.Periodic, i+d, j-1)
+	nb[HexLowerLeft] = s.latticeCell(lat.Periodic, i-1+d, j-1)
+	return nb
+}
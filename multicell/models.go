@@ -1,128 +1,188 @@
 package multicell
 
 import (
+	"encoding/json"
 	"log"
 	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 )
 
-type model_t struct {
-	cue     bool
-	develop bool
-	nLayers int
+// Description of a network architecture (a model).
+// Built-in models are in the "models" map; others are read from JSON files.
+type ModelSpec struct {
+	Name       string
+	Cue        bool       // with cue or not
+	Develop    bool       // multi-step development
+	MaxDevelop int        // overrides the default of Develop if > 0
+	Alpha      float64    // overrides the default of Develop if > 0
+	LenLayer   []float64  // lengths of layers in units of LenFace*(number of faces)
+	Links      []LinkSpec // genome matrices
+	OmegaRule  string     // "Fanin" (default) or "Fixed"
+	Omega      []float64  // scaling factors for "Fixed"
+	Activation []string   // activation function of each layer (nil: default)
 }
 
-var models = map[string]model_t{
-	"Full":  {true, true, 3},
-	"NoCue": {false, true, 3},
-	"NoDev": {true, false, 3},
-	"NoHie": {true, true, 0},
+// Genome matrix from layer From to layer To.
+type LinkSpec struct {
+	To      int
+	From    int
+	Density float64
+}
 
-	"Hie2": {true, true, 2},
-	"Hie1": {true, true, 1},
+var models = map[string]ModelSpec{
+	"Full":  specSL(3, true, true),
+	"NoCue": specSL(3, false, true),
+	"NoDev": specSL(3, true, false),
+	"NoHie": specSL(0, true, true),
 
-	"NullHie": {false, false, 3},
-	"NullCue": {true, false, 0},
-	"NullDev": {false, true, 0},
-	"Null":    {false, false, 0},
-}
+	"Hie2": specSL(2, true, true),
+	"Hie1": specSL(1, true, true),
 
-// Self-loop for hidden layers
-func (s *Setting) SetLayerSL(n int) {
-	s.NumLayers = n + 2
-	s.LenLayer = make([]int, s.NumLayers)
-	slen := s.LenFace * NumFaces
-	s.LenLayer[0] = slen
-	s.LenLayer[s.NumLayers-1] = slen
+	"NullHie": specSL(3, false, false),
+	"NullCue": specSL(0, true, false),
+	"NullDev": specSL(0, false, true),
+	"Null":    specSL(0, false, false),
 
-	s.Topology = NewSliceOfMaps[float64](s.NumLayers)
+	"FullM1":  specM1(3, true, true),
+	"Hie2M1":  specM1(2, true, true),
+	"Hie1M1":  specM1(1, true, true),
+	"NoHieM1": specM1(0, true, true),
+}
 
+// n hidden layers with self-loops.
+func specSL(n int, cue, develop bool) ModelSpec {
+	spec := ModelSpec{Cue: cue, Develop: develop}
 	switch n {
 	case 3:
-		s.LenLayer[1] = slen
-		s.LenLayer[2] = slen
-		s.LenLayer[3] = slen
-
-		// feedforward
-		s.Topology.Set(1, 0, default_density)
-		s.Topology.Set(2, 1, default_density)
-		s.Topology.Set(3, 2, default_density)
-		s.Topology.Set(4, 3, default_density)
-		// feedback
-		s.Topology.Set(1, 1, default_density)
-		s.Topology.Set(2, 2, default_density)
-		s.Topology.Set(3, 3, default_density)
+		spec.LenLayer = []float64{1, 1, 1, 1, 1}
+		spec.Links = []LinkSpec{
+			// feedforward
+			{1, 0, default_density},
+			{2, 1, default_density},
+			{3, 2, default_density},
+			{4, 3, default_density},
+			// feedback
+			{1, 1, default_density},
+			{2, 2, default_density},
+			{3, 3, default_density}}
 	case 2:
-		s.LenLayer[1] = slen * 3 / 2
-		s.LenLayer[2] = slen * 3 / 2
-		// feedforward
-		s.Topology.Set(1, 0, default_density*2.0/3.0)
-		s.Topology.Set(2, 1, default_density*8.0/9.0)
-		s.Topology.Set(3, 2, default_density*2.0/3.0)
-		// feedback
-		s.Topology.Set(1, 1, default_density*2.0/3.0)
-		s.Topology.Set(2, 2, default_density*2.0/3.0)
+		spec.LenLayer = []float64{1, 1.5, 1.5, 1}
+		spec.Links = []LinkSpec{
+			// feedforward
+			{1, 0, default_density * 2.0 / 3.0},
+			{2, 1, default_density * 8.0 / 9.0},
+			{3, 2, default_density * 2.0 / 3.0},
+			// feedback
+			{1, 1, default_density * 2.0 / 3.0},
+			{2, 2, default_density * 2.0 / 3.0}}
 	case 1:
-		s.LenLayer[1] = slen * 3
-		// feedforward
-		s.Topology.Set(1, 0, default_density*2.0/3.0)
-		s.Topology.Set(2, 1, default_density*2.0/3.0)
-		// feedback
-		s.Topology.Set(1, 1, default_density/3.0)
+		spec.LenLayer = []float64{1, 3, 1}
+		spec.Links = []LinkSpec{
+			// feedforward
+			{1, 0, default_density * 2.0 / 3.0},
+			{2, 1, default_density * 2.0 / 3.0},
+			// feedback
+			{1, 1, default_density / 3.0}}
 	case 0:
-		s.Topology.Set(1, 0, default_density*7.0)
-	default:
-		log.Printf("SetLayer: unknown number of layers: %d\n", n)
-		panic("SetLayer")
+		spec.LenLayer = []float64{1, 1}
+		spec.Links = []LinkSpec{{1, 0, default_density * 7.0}}
 	}
+	return spec
 }
 
-// Feedback loop to the previous layer
-func (s *Setting) SetLayerM1(n int) {
-	s.NumLayers = n + 2
-	s.LenLayer = make([]int, s.NumLayers)
-	slen := s.LenFace * NumFaces
-	s.LenLayer[0] = slen
-	s.LenLayer[s.NumLayers-1] = slen
-
-	s.Topology = NewSliceOfMaps[float64](s.NumLayers)
-
+// n hidden layers with feedback loops to the previous layer.
+func specM1(n int, cue, develop bool) ModelSpec {
+	spec := ModelSpec{Cue: cue, Develop: develop}
 	switch n {
 	case 3:
-		s.LenLayer[1] = slen
-		s.LenLayer[2] = slen
-		s.LenLayer[3] = slen
-
-		// feedforward
-		s.Topology.Set(1, 0, default_density)
-		s.Topology.Set(2, 1, default_density)
-		s.Topology.Set(3, 2, default_density)
-		s.Topology.Set(4, 3, default_density)
-		// feedback
-		s.Topology.Set(1, 2, default_density)
-		s.Topology.Set(2, 3, default_density)
-
+		spec.LenLayer = []float64{1, 1, 1, 1, 1}
+		spec.Links = []LinkSpec{
+			// feedforward
+			{1, 0, default_density},
+			{2, 1, default_density},
+			{3, 2, default_density},
+			{4, 3, default_density},
+			// feedback
+			{1, 2, default_density},
+			{2, 3, default_density}}
 	case 2:
-		s.LenLayer[1] = slen * 3 / 2
-		s.LenLayer[2] = slen * 3 / 2
-		//feedforward
-		s.Topology.Set(1, 0, default_density*2.0/3.0)
-		s.Topology.Set(2, 1, default_density*8.0/9.0)
-		s.Topology.Set(3, 2, default_density*2.0/3.0)
-		// feedback
-		s.Topology.Set(1, 2, default_density*8.0/9.0)
-
+		spec.LenLayer = []float64{1, 1.5, 1.5, 1}
+		spec.Links = []LinkSpec{
+			// feedforward
+			{1, 0, default_density * 2.0 / 3.0},
+			{2, 1, default_density * 8.0 / 9.0},
+			{3, 2, default_density * 2.0 / 3.0},
+			// feedback
+			{1, 2, default_density * 8.0 / 9.0}}
 	case 1:
-		s.LenLayer[1] = slen * 3
-		//feedforward
-		s.Topology.Set(1, 0, default_density*2.0/3.0)
-		s.Topology.Set(2, 1, default_density*2.0/3.0)
-		// feedback
-		s.Topology.Set(1, 1, default_density*2.0/9.0)
+		spec.LenLayer = []float64{1, 3, 1}
+		spec.Links = []LinkSpec{
+			// feedforward
+			{1, 0, default_density * 2.0 / 3.0},
+			{2, 1, default_density * 2.0 / 3.0},
+			// feedback
+			{1, 1, default_density * 2.0 / 9.0}}
 	case 0:
-		s.Topology.Set(1, 0, default_density*6.0)
+		spec.LenLayer = []float64{1, 1}
+		spec.Links = []LinkSpec{{1, 0, default_density * 6.0}}
+	}
+	return spec
+}
+
+func BuiltinModelSpec(name string) (ModelSpec, bool) {
+	spec, ok := models[name]
+	spec.Name = name
+	return spec, ok
+}
+
+func LoadModelSpec(filename string) ModelSpec {
+	buffer, err := os.ReadFile(filename)
+	JustFail(err)
+	var spec ModelSpec
+	err = json.Unmarshal(buffer, &spec)
+	JustFail(err)
+	if spec.Name == "" {
+		spec.Name = strings.TrimSuffix(filepath.Base(filename), ".json")
+	}
+	return spec
+}
+
+func (spec ModelSpec) Dump(filename string) {
+	json, err := json.MarshalIndent(spec, "", "    ")
+	JustFail(err)
+	JustFail(os.WriteFile(filename, json, 0644))
+	log.Printf("Model saved in: %s\n", filename)
+}
+
+func (spec ModelSpec) Check() {
+	nl := len(spec.LenLayer)
+	if nl < 2 || spec.LenLayer[0] != 1 || spec.LenLayer[nl-1] != 1 {
+		log.Fatalf("Model %s: need >= 2 layers; the first and last must be of length 1\n", spec.Name)
+	}
+	for _, link := range spec.Links {
+		if link.To < 0 || link.To >= nl || link.From < 0 || link.From >= nl {
+			log.Fatalf("Model %s: link %d <- %d out of range\n", spec.Name, link.To, link.From)
+		}
+	}
+	switch spec.OmegaRule {
+	case "", "Fanin":
+	case "Fixed":
+		if len(spec.Omega) != nl {
+			log.Fatalf("Model %s: need %d Omega values\n", spec.Name, nl)
+		}
 	default:
-		log.Printf("SetLayer: unknown number of layers: %d\n", n)
-		panic("SetLayer")
+		log.Fatalf("Model %s: unknown OmegaRule %s\n", spec.Name, spec.OmegaRule)
+	}
+	if spec.Activation != nil {
+		if len(spec.Activation) != nl {
+			log.Fatalf("Model %s: need %d activation functions\n", spec.Name, nl)
+		}
+		for _, name := range spec.Activation {
+			CheckActivation(name)
+		}
 	}
 }
 
@@ -136,6 +196,7 @@ func (s *Setting) SetDevelop(flag bool) {
 	}
 }
 
+// 1/sqrt(expected fan-in) for each layer.
 func (s *Setting) SetOmega() {
 	s.Omega = make(Vec, s.NumLayers)
 
@@ -151,14 +212,45 @@ func (s *Setting) SetOmega() {
 	}
 }
 
-func (s *Setting) SetModel(basename string) {
-	m, ok := models[basename]
-	if ok {
-		s.Basename = basename
-		s.SetLayerSL(m.nLayers)
-		s.SetDevelop(m.develop)
-		s.WithCue = m.cue
+func (s *Setting) SetModelSpec(spec ModelSpec) {
+	spec.Check()
+	s.Basename = spec.Name
+	s.NumLayers = len(spec.LenLayer)
+	s.LenLayer = make([]int, s.NumLayers)
+	slen := s.LenFace * s.NumCellFaces()
+	for l, f := range spec.LenLayer {
+		s.LenLayer[l] = int(f * float64(slen))
+	}
+	s.Topology = NewSliceOfMaps[float64](s.NumLayers)
+	for _, link := range spec.Links {
+		s.Topology.Set(link.To, link.From, link.Density)
+	}
+	s.SetDevelop(spec.Develop)
+	if spec.MaxDevelop > 0 {
+		s.MaxDevelop = spec.MaxDevelop
+	}
+	if spec.Alpha > 0 {
+		s.Alpha = spec.Alpha
+	}
+	s.WithCue = spec.Cue
+	if spec.Activation != nil {
+		s.Activation = slices.Clone(spec.Activation)
+	} else {
+		s.Activation = DefaultActivation(s.NumLayers)
+	}
+	if spec.OmegaRule == "Fixed" {
+		s.Omega = Vec(spec.Omega).Clone()
+	} else {
 		s.SetOmega()
+	}
+}
+
+// A built-in model name or a model JSON file.
+func (s *Setting) SetModel(basename string) {
+	if spec, ok := BuiltinModelSpec(basename); ok {
+		s.SetModelSpec(spec)
+	} else if strings.HasSuffix(basename, ".json") {
+		s.SetModelSpec(LoadModelSpec(basename))
 	} else {
 		log.Fatal("Unknown model: " + basename)
 	}
@@ -0,0 +1,353 @@
+package multicell
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"slices"
+
+	"gonum.org/v1/gonum/graph/community"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+/*
+	Network statistics of genomes.
+
+	The units of all layers are the nodes of one signed directed graph;
+	an element M[l][k][i][j] is an edge from unit j of layer k to unit i
+	of layer l. For each genome:
+
+	- feed-forward loops (a->b->c with a->c) and 3-node feedback loops
+	  (a->b->c->a), with z-scores against degree-preserving randomized
+	  networks (edge swaps within each block M[l][k], self-loops kept);
+	  FFLs are coherent if the sign of a->c is that of the path a->b->c,
+	  FBLs are positive if the product of their signs is;
+	- Newman modularity of the undirected graph (Louvain partition);
+	- in- and out-degree distributions of each layer;
+	- fractions of edges in self-loop blocks M[l][l], feedforward
+	  blocks (l > k) and feedback blocks (l < k).
+*/
+
+const net_swaps_per_edge = 10 // edge swaps per edge in a randomized network
+
+type Network struct {
+	Layer []int         // layer of each node
+	Out   []map[int]int // Out[a][b]: sign of the edge a->b
+	In    []map[int]int // In[b][a]: sign of the edge a->b
+}
+
+func (s *Setting) GenomeNetwork(g Genome) Network {
+	offset := make([]int, s.NumLayers)
+	var layer []int
+	for l, nl := range s.LenLayer {
+		offset[l] = len(layer)
+		for range nl {
+			layer = append(layer, l)
+		}
+	}
+	net := newNetwork(layer)
+	s.Topology.DoOrdered(func(l, k int, _ float64) {
+		g.M[l][k].DoOrdered(func(i, j int, v float64) {
+			net.addEdge(offset[k]+j, offset[l]+i, sign(v))
+		})
+	})
+	return net
+}
+
+func newNetwork(layer []int) Network {
+	net := Network{
+		Layer: layer,
+		Out:   make([]map[int]int, len(layer)),
+		In:    make([]map[int]int, len(layer))}
+	for a := range layer {
+		net.Out[a] = make(map[int]int)
+		net.In[a] = make(map[int]int)
+	}
+	return net
+}
+
+func (net Network) addEdge(a, b, sgn int) {
+	net.Out[a][b] = sgn
+	net.In[b][a] = sgn
+}
+
+func (net Network) removeEdge(a, b int) {
+	delete(net.Out[a], b)
+	delete(net.In[b], a)
+}
+
+// Edges in the order of nodes (for reproducible randomization).
+func (net Network) Edges() [][3]int {
+	var edges [][3]int
+	for a, out := range net.Out {
+		for _, b := range slices.Sorted(maps.Keys(out)) {
+			edges = append(edges, [3]int{a, b, out[b]})
+		}
+	}
+	return edges
+}
+
+// Numbers of coherent and incoherent feed-forward loops a->b->c, a->c
+// (distinct nodes).
+func (net Network) CountFFL() (int, int) {
+	ncoh, ninc := 0, 0
+	for a, out := range net.Out {
+		for c, sac := range out {
+			if c == a {
+				continue
+			}
+			for b, sab := range out {
+				if b != a && b != c {
+					if sbc, ok := net.In[c][b]; ok {
+						if sab*sbc == sac {
+							ncoh++
+						} else {
+							ninc++
+						}
+					}
+				}
+			}
+		}
+	}
+	return ncoh, ninc
+}
+
+// Numbers of positive and negative feedback loops a->b->c->a (distinct nodes).
+func (net Network) CountFBL() (int, int) {
+	npos, nneg := 0, 0
+	for a, out := range net.Out {
+		for b, sab := range out {
+			if b == a {
+				continue
+			}
+			for c, sbc := range net.Out[b] {
+				if c != a && c != b {
+					if sca, ok := net.Out[c][a]; ok {
+						if sab*sbc*sca > 0 {
+							npos++
+						} else {
+							nneg++
+						}
+					}
+				}
+			}
+		}
+	}
+	return npos / 3, nneg / 3
+}
+
+// Randomized copy with the same in- and out-degrees (and signs of edges)
+// in each block M[l][k]: edges a->b and c->d of the same block are swapped
+// to a->d and c->b unless that makes a self-loop or a multiple edge.
+// Self-loops are left as they are.
+func (net Network) Randomize(rng *rand.Rand) Network {
+	edges := net.Edges()
+	rnet := newNetwork(net.Layer)
+	blocks := make(map[[2]int][]int) // edges (not self-loops) of each block
+	var swappable []int
+	for i, e := range edges {
+		rnet.addEdge(e[0], e[1], e[2])
+		if e[0] != e[1] {
+			lk := [2]int{net.Layer[e[1]], net.Layer[e[0]]}
+			blocks[lk] = append(blocks[lk], i)
+			swappable = append(swappable, i)
+		}
+	}
+	if len(swappable) < 2 {
+		return rnet
+	}
+	for range net_swaps_per_edge * len(swappable) {
+		i := swappable[rng.IntN(len(swappable))]
+		block := blocks[[2]int{net.Layer[edges[i][1]], net.Layer[edges[i][0]]}]
+		j := block[rng.IntN(len(block))]
+		a, b := edges[i][0], edges[i][1]
+		c, d := edges[j][0], edges[j][1]
+		if a == c || b == d || a == d || c == b {
+			continue
+		}
+		if _, ok := rnet.Out[a][d]; ok {
+			continue
+		}
+		if _, ok := rnet.Out[c][b]; ok {
+			continue
+		}
+		rnet.removeEdge(a, b)
+		rnet.removeEdge(c, d)
+		rnet.addEdge(a, d, edges[i][2])
+		rnet.addEdge(c, b, edges[j][2])
+		edges[i][1], edges[j][1] = d, b
+	}
+	return rnet
+}
+
+// Newman modularity of the undirected graph (without self-loops).
+func (net Network) Modularity(rng *rand.Rand) float64 {
+	g := simple.NewUndirectedGraph()
+	for a := range net.Layer {
+		g.AddNode(simple.Node(a))
+	}
+	for _, e := range net.Edges() {
+		if e[0] != e[1] {
+			g.SetEdge(simple.Edge{F: simple.Node(e[0]), T: simple.Node(e[1])})
+		}
+	}
+	if g.Edges().Len() == 0 {
+		return 0
+	}
+	reduced := community.Modularize(g, 1, distSource{rng})
+	return community.Q(g, reduced.Communities(), 1)
+}
+
+// Histograms of in- and out-degrees of the nodes in each layer.
+func (net Network) DegreeHist(nlayers int) ([][]int, [][]int) {
+	in := make([][]int, nlayers)
+	out := make([][]int, nlayers)
+	hist := func(h []int, k int) []int {
+		for len(h) <= k {
+			h = append(h, 0)
+		}
+		h[k]++
+		return h
+	}
+	for a, l := range net.Layer {
+		in[l] = hist(in[l], len(net.In[a]))
+		out[l] = hist(out[l], len(net.Out[a]))
+	}
+	return in, out
+}
+
+type NetStats struct {
+	FFL        float64
+	FFLz       float64 // z-score against the randomized networks
+	FBL        float64
+	FBLz       float64
+	CohFFL     float64 // coherent feed-forward loops
+	IncFFL     float64 // incoherent
+	PosFBL     float64 // positive feedback loops
+	NegFBL     float64 // negative
+	Modularity float64
+	SelfFrac   float64 // fraction of edges in M[l][l]
+	FFFrac     float64 // ... in M[l][k] (l > k)
+	FBFrac     float64 // ... in M[l][k] (l < k)
+	InDeg      [][]int // histograms per layer
+	OutDeg     [][]int
+}
+
+func zscore(x float64, null Vec) float64 {
+	ave, sd := avesd(null)
+	if sd == 0 {
+		return 0
+	}
+	return (x - ave) / sd
+}
+
+// Network statistics of a genome with nnull randomized networks.
+func (s *Setting) GetNetStats(rng *rand.Rand, g Genome, nnull int) NetStats {
+	net := s.GenomeNetwork(g)
+	ncoh, ninc := net.CountFFL()
+	npos, nneg := net.CountFBL()
+	stats := NetStats{
+		FFL:        float64(ncoh + ninc),
+		FBL:        float64(npos + nneg),
+		CohFFL:     float64(ncoh),
+		IncFFL:     float64(ninc),
+		PosFBL:     float64(npos),
+		NegFBL:     float64(nneg),
+		Modularity: net.Modularity(rng)}
+	var ffl, fbl Vec
+	for range nnull {
+		rnet := net.Randomize(rng)
+		ncoh, ninc := rnet.CountFFL()
+		npos, nneg := rnet.CountFBL()
+		ffl = append(ffl, float64(ncoh+ninc))
+		fbl = append(fbl, float64(npos+nneg))
+	}
+	if nnull > 1 {
+		stats.FFLz = zscore(stats.FFL, ffl)
+		stats.FBLz = zscore(stats.FBL, fbl)
+	}
+	nedges := 0.0
+	s.Topology.Do(func(l, k int, _ float64) {
+		ne := 0.0
+		for _, mi := range g.M[l][k].M {
+			ne += float64(len(mi))
+		}
+		nedges += ne
+		switch {
+		case l == k:
+			stats.SelfFrac += ne
+		case l > k:
+			stats.FFFrac += ne
+		default:
+			stats.FBFrac += ne
+		}
+	})
+	if nedges > 0 {
+		stats.SelfFrac /= nedges
+		stats.FFFrac /= nedges
+		stats.FBFrac /= nedges
+	}
+	stats.InDeg, stats.OutDeg = net.DegreeHist(s.NumLayers)
+	return stats
+}
+
+func (pop *Population) GetNetStats(s *Setting, nnull int) []NetStats {
+	stats := make([]NetStats, len(pop.Indivs))
+	rngs := s.NewStreams(len(pop.Indivs))
+	s.ParallelFor(len(pop.Indivs), func(i int) {
+		stats[i] = s.GetNetStats(rngs[i], pop.Indivs[i].Genome, nnull)
+	})
+	return stats
+}
+
+// Population means in a "Net" line, followed by the pooled degree
+// distributions in "Deg" lines (layer, in/out, degree, count).
+func PrintNetStats(fout io.Writer, iepoch, igen int, stats []NetStats) {
+	var cols [12]Vec
+	for _, st := range stats {
+		for c, x := range []float64{st.FFL, st.FFLz, st.FBL, st.FBLz,
+			st.Modularity, st.SelfFrac, st.FFFrac, st.FBFrac,
+			st.CohFFL, st.IncFFL, st.PosFBL, st.NegFBL} {
+			cols[c] = append(cols[c], x)
+		}
+	}
+	fmt.Fprintf(fout, "Net\t%d\t%d", iepoch, igen)
+	for _, col := range cols {
+		ave, _ := avesd(col)
+		fmt.Fprintf(fout, "\t%e", ave)
+	}
+	fmt.Fprintf(fout, "\n")
+
+	pool := func(dir string, hists func(NetStats) [][]int) {
+		var total [][]int
+		for _, st := range stats {
+			for l, h := range hists(st) {
+				for len(total) <= l {
+					total = append(total, nil)
+				}
+				for len(total[l]) < len(h) {
+					total[l] = append(total[l], 0)
+				}
+				for k, c := range h {
+					total[l][k] += c
+				}
+			}
+		}
+		for l, h := range total {
+			for k, c := range h {
+				if c > 0 {
+					fmt.Fprintf(fout, "Deg\t%d\t%d\t%d\t%s\t%d\t%d\n", iepoch, igen, l, dir, k, c)
+				}
+			}
+		}
+	}
+	pool("in", func(st NetStats) [][]int { return st.InDeg })
+	pool("out", func(st NetStats) [][]int { return st.OutDeg })
+}
+
+// Header of the "Net" lines.
+func PrintNetStatsHeader(fout io.Writer) {
+	fmt.Fprintf(fout, "#Net\tEpoch\tGen\tFFL\tFFLz\tFBL\tFBLz\tModularity\tSelfFrac\tFFFrac\tFBFrac\tCohFFL\tIncFFL\tPosFBL\tNegFBL\n")
+	fmt.Fprintf(fout, "#Deg\tEpoch\tGen\tLayer\tDir\tDegree\tCount\n")
+}
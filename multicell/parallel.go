@@ -0,0 +1,36 @@
+package multicell
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Number of worker goroutines.
+func (s *Setting) Workers() int {
+	if s.NumWorkers > 0 {
+		return s.NumWorkers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// Call f(i) for i = 0, ..., n-1 on a bounded pool of workers.
+// f must write its result by index i; the order of calls is not defined.
+func (s *Setting) ParallelFor(n int, f func(i int)) {
+	nw := min(n, s.Workers())
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(nw)
+	for range nw {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				f(i)
+			}
+		}()
+	}
+	for i := range n {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
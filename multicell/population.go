@@ -1,21 +1,25 @@
 package multicell
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
-	"math/rand/v2"
 	"os"
+	"slices"
 	"sort"
 )
 
 type Population struct {
-	Iepoch int // epoch
-	Igen   int // generation
-	Env    Environment
-	Indivs []Individual
+	Iepoch   int           // epoch
+	Igen     int           // generation
+	Env      Environment   // environment in effect
+	EnvState Vec           // hidden state of environmental dynamics
+	EnvHist  []Environment // environments of the last CueLag generations
+	Indivs   []Individual
 }
 
 type PopStats struct {
@@ -53,8 +57,9 @@ func (pop *Population) GetPopStats() PopStats {
 
 func (s *Setting) NewPopulation(env Environment) Population {
 	var indivs []Individual
+	rng := s.Rand()
 	for id := range s.MaxPopulation {
-		indiv := s.NewIndividual(id, env)
+		indiv := s.NewIndividual(rng, id, env)
 		indiv.Genome = s.NewGenome()
 		indivs = append(indivs, indiv)
 	}
@@ -76,102 +81,168 @@ func (pop *Population) GetMaxFitness() float64 {
 }
 
 func (pop *Population) Develop(s *Setting, env Vec) {
-	ch := make(chan Individual)
-
-	for _, indiv := range pop.Indivs {
-		go func(indiv Individual) {
-			ch <- indiv.Develop(s, env)
-		}(indiv)
-	}
+	pop.develop(s, env, false)
+}
 
-	for i := range pop.Indivs {
-		pop.Indivs[i] = <-ch
+// Develop; with record, the trajectories of the individuals in
+// s.RecordDev are saved (see devtraj.go).
+func (pop *Population) develop(s *Setting, env Vec, record bool) {
+	cue := pop.CueSource(s, env)
+	rngs := s.NewStreams(len(pop.Indivs))
+	if record && len(s.RecordDev) > 0 {
+		pop.developRecord(s, env, cue, rngs)
+		return
 	}
-	pop.Sort()
+	s.ParallelFor(len(pop.Indivs), func(i int) {
+		pop.Indivs[i].DevelopCue(rngs[i], s, env, cue)
+	})
 }
 
 func (pop *Population) Select(s *Setting) Population {
-	var indivs []Individual
-	maxfit := pop.GetMaxFitness()
-	npop := 0
-	for {
-		i := rand.IntN(s.MaxPopulation)
-		wfit := pop.Indivs[i].Fitness / maxfit
-
-		if rand.Float64() < wfit {
-			indivs = append(indivs, pop.Indivs[i])
-			npop++
-		}
-		if npop == s.MaxPopulation {
-			break
+	fits := make(Vec, len(pop.Indivs))
+	for i, indiv := range pop.Indivs {
+		fits[i] = indiv.Fitness
+	}
+	if pop.GetMaxFitness() == 0 {
+		switch s.Extinction {
+		case ExtinctionAbort:
+			log.Fatalf("Extinction at epoch %d, generation %d\n", pop.Iepoch, pop.Igen)
+		case ExtinctionDrift, "":
+			log.Printf("Zero fitness at epoch %d, generation %d; selecting at random\n",
+				pop.Iepoch, pop.Igen)
+			fits.SetAll(1.0)
+		default:
+			log.Fatal("Unknown extinction policy: " + s.Extinction)
 		}
 	}
 
+	parents := s.GetSelector().Select(s.Rand(), fits, s.MaxPopulation)
+	indivs := make([]Individual, len(parents))
+	for k, i := range parents {
+		indivs[k] = pop.Indivs[i]
+	}
+
 	return Population{
-		Iepoch: pop.Iepoch,
-		Igen:   pop.Igen,
-		Env:    pop.Env,
-		Indivs: indivs}
+		Iepoch:   pop.Iepoch,
+		Igen:     pop.Igen,
+		Env:      pop.Env,
+		EnvState: pop.EnvState,
+		EnvHist:  pop.EnvHist,
+		Indivs:   indivs}
 }
 
-func (pop *Population) Reproduce(s *Setting) Population {
-	ch := make(chan Individual, 2)
-
-	for i := 1; i < len(pop.Indivs); i += 2 {
-		go func(mom, dad Individual) {
-			kid0, kid1 := s.MateIndividuals(mom, dad, pop.Env)
-			ch <- kid0
-			ch <- kid1
-		}(pop.Indivs[i-1], pop.Indivs[i])
+// The s.NumElites fittest individuals.
+func (pop *Population) Elites(s *Setting) []Individual {
+	fits := make([]float64, len(pop.Indivs))
+	for i, indiv := range pop.Indivs {
+		fits[i] = indiv.Fitness
 	}
+	var elites []Individual
+	for _, i := range rankByFitness(fits)[:min(s.NumElites, len(fits))] {
+		elites = append(elites, pop.Indivs[i])
+	}
+	return elites
+}
+
+// Replace the last kids by (copies of) the elites.
+func (pop *Population) AddElites(s *Setting, elites []Individual) {
+	n := len(pop.Indivs)
+	for k, elite := range elites[:min(len(elites), n)] {
+		i := n - 1 - k
+		indiv := elite.Clone(s, pop.Env)
+		indiv.Id = i
+		indiv.MomId = elite.Id
+		indiv.DadId = elite.Id
+		pop.Indivs[i] = indiv
+	}
+}
 
-	var kids []Individual
-	for i := 1; i < len(pop.Indivs); i += 2 {
-		kid := <-ch
-		kid.Id = i - 1
-		kids = append(kids, kid)
+func (pop *Population) Reproduce(s *Setting) Population {
+	return pop.ReproduceInto(s, nil)
+}
 
-		kid = <-ch
-		kid.Id = i
-		kids = append(kids, kid)
+// Same as Reproduce, but the kids reuse the cells of the discarded
+// individuals spare (which may be the parents: mating reads only genomes).
+func (pop *Population) ReproduceInto(s *Setting, spare []Individual) Population {
+	// kids are placed by the parents' position.
+	npair := len(pop.Indivs) / 2
+	kids := make([]Individual, 2*npair)
+	rngs := s.NewStreams(npair)
+	cells := func(i int) []Cell {
+		if i < len(spare) {
+			return spare[i].Cells
+		}
+		return nil
 	}
+	s.ParallelFor(npair, func(n int) {
+		i := 2 * n
+		kids[i], kids[i+1] = s.MateIndividualsInto(rngs[n], pop.Indivs[i], pop.Indivs[i+1], pop.Env,
+			cells(i), cells(i+1))
+		kids[i].Id = i
+		kids[i+1].Id = i + 1
+	})
 
 	return Population{
-		Iepoch: pop.Iepoch,
-		Igen:   pop.Igen + 1,
-		Env:    pop.Env,
-		Indivs: kids}
+		Iepoch:   pop.Iepoch,
+		Igen:     pop.Igen + 1,
+		Env:      pop.Env,
+		EnvState: pop.EnvState,
+		EnvHist:  pop.EnvHist,
+		Indivs:   kids}
 }
 
 func (pop0 *Population) Evolve(s *Setting, env Environment) (Population, string) {
 	pop := *pop0
 	pop.Initialize(s, env)
-	for igen := range s.MaxGeneration {
+	pop.Igen = 0
+	return pop.EvolveFrom(s, env)
+}
+
+// Evolve from generation pop.Igen to the end of the epoch without initialization.
+func (pop0 *Population) EvolveFrom(s *Setting, env Environment) (Population, string) {
+	pop := *pop0
+	envlog := pop.OpenEnvLog(s)
+	defer envlog.Close()
+	dynamics := s.GetEnvDynamics()
+	for igen := pop.Igen; igen < s.MaxGeneration; igen++ {
 		pop.Igen = igen
-		pop.Develop(s, pop.Env)
+		if interrupted.Load() {
+			file := pop.SaveCheckpoint(s, env)
+			log.Fatalf("Interrupted; resume with: %s\n", file)
+		}
+		if s.CheckpointEvery > 0 && igen > 0 && igen%s.CheckpointEvery == 0 {
+			pop.SaveCheckpoint(s, env)
+		}
+		pop.develop(s, pop.Env, s.ProductionRun)
+		pop.LogEnv(s, envlog, env)
+		pop.PushEnvHist(s)
 		stats := pop.GetPopStats()
 		stats.Print(pop.Iepoch, pop.Igen)
 		if s.ProductionRun { // Dump before Selection
 			pop.Dump(s)
 		}
-		pop = pop.Select(s)
-		//pop.Env = pop.Env.MarkovFlip(s, env)
-		//pop.Env = pop.Env.BlockFlip(s, env)
-		if s.EnvFlip {
-			pop.Env = pop.Env.BlockFlipNR(s, env)
-		} else {
-			pop.Env = env
+		elites := pop.Elites(s)
+		// The storage of this generation is reused by the next,
+		// except for the caller's individuals.
+		var spare []Individual
+		if igen > pop0.Igen {
+			spare = pop.Indivs
 		}
-		pop = pop.Reproduce(s)
+		pop = pop.Select(s)
+		pop.Env = dynamics.Next(s, &pop, env)
+		pop = pop.ReproduceInto(s, spare)
+		pop.AddElites(s, elites)
 	}
 	pop.Igen = s.MaxGeneration
-	pop.Develop(s, env)
+	pop.develop(s, env, true)
 	dumpfile := pop.Dump(s)
 	return pop, dumpfile
 }
 
 func (pop *Population) Initialize(s *Setting, env Environment) {
 	pop.Env = env.Clone()
+	pop.EnvState = nil
+	pop.EnvHist = nil
 	for i := range pop.Indivs {
 		pop.Indivs[i].Initialize(s, env)
 	}
@@ -224,6 +295,19 @@ func (pop *Population) Sort() {
 	})
 }
 
+// Sort the individuals by fitness in descending order (stable).
+func (pop *Population) SortByFitness() {
+	fits := make([]float64, len(pop.Indivs))
+	for i, indiv := range pop.Indivs {
+		fits[i] = indiv.Fitness
+	}
+	indivs := make([]Individual, len(pop.Indivs))
+	for k, i := range rankByFitness(fits) {
+		indivs[k] = pop.Indivs[i]
+	}
+	pop.Indivs = indivs
+}
+
 func (s *Setting) LoadPopulation(filename string) Population {
 	log.Printf("Load population from: %s\n", filename)
 	fin, err := os.Open(filename)
@@ -234,15 +318,83 @@ func (s *Setting) LoadPopulation(filename string) Population {
 	JustFail(err)
 	defer finz.Close()
 
-	decoder := gob.NewDecoder(finz)
+	buffer, err := io.ReadAll(finz)
+	JustFail(err)
 
 	var pop Population
-	err = decoder.Decode(&pop)
-	JustFail(err)
+	if err = gob.NewDecoder(bytes.NewReader(buffer)).Decode(&pop); err != nil {
+		// dumps of the fixed rectangular cells
+		var lpop legacyPopulation
+		if gob.NewDecoder(bytes.NewReader(buffer)).Decode(&lpop) != nil {
+			JustFail(err)
+		}
+		log.Printf("%s: converted from the format with Facing [%d]int\n", filename, NumFaces)
+		pop = lpop.convert()
+	}
 	pop.Sort()
 	return pop
 }
 
+// Dumps before the lattices of lattice.go, where a cell always had
+// NumFaces faces (Cell.Facing was an array). Gob matches the fields by
+// name, so only the types containing Facing are redefined.
+type legacyCell struct {
+	Id     int
+	Facing [NumFaces]int
+	Cue    []Vec
+	S      []Vec
+	Pave   Vec
+	Pvar   Vec
+}
+
+type legacyIndividual struct {
+	Id      int
+	MomId   int
+	DadId   int
+	Genome  Genome
+	Cells   []legacyCell
+	Ndev    int
+	Align   float64
+	Fitness float64
+}
+
+type legacyPopulation struct {
+	Iepoch int
+	Igen   int
+	Env    Environment
+	Indivs []legacyIndividual
+}
+
+func (lpop legacyPopulation) convert() Population {
+	pop := Population{
+		Iepoch: lpop.Iepoch,
+		Igen:   lpop.Igen,
+		Env:    lpop.Env,
+		Indivs: make([]Individual, len(lpop.Indivs))}
+	for i, li := range lpop.Indivs {
+		indiv := Individual{
+			Id:      li.Id,
+			MomId:   li.MomId,
+			DadId:   li.DadId,
+			Genome:  li.Genome,
+			Cells:   make([]Cell, len(li.Cells)),
+			Ndev:    li.Ndev,
+			Align:   li.Align,
+			Fitness: li.Fitness}
+		for j, lc := range li.Cells {
+			indiv.Cells[j] = Cell{
+				Id:     lc.Id,
+				Facing: slices.Clone(lc.Facing[:]),
+				Cue:    lc.Cue,
+				S:      lc.S,
+				Pave:   lc.Pave,
+				Pvar:   lc.Pvar}
+		}
+		pop.Indivs[i] = indiv
+	}
+	return pop
+}
+
 func (s *Setting) LoadPopulationJSON(filename string, env Environment) Population {
 	log.Printf("Load population JSON from: %s\n", filename)
 	buffer, err := os.ReadFile(filename)
@@ -261,6 +413,14 @@ func (pop *Population) StateVecs() []Vec {
 	return vecs
 }
 
+func (pop *Population) Genomes() []Genome {
+	gs := make([]Genome, len(pop.Indivs))
+	for i, indiv := range pop.Indivs {
+		gs[i] = indiv.Genome
+	}
+	return gs
+}
+
 func (pop *Population) GenomeVecs(s *Setting) []Vec {
 	vecs := make([]Vec, len(pop.Indivs))
 	for i, indiv := range pop.Indivs {
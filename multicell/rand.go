@@ -0,0 +1,97 @@
+package multicell
+
+/*
+	Random number streams.
+
+	Sequential code draws from the master stream of a Setting (s.Rand()),
+	which is seeded by Setting.Seed. Code running in worker goroutines
+	takes its own stream drawn from the master (s.NewStreams(n)), one per
+	task (not per goroutine), so that the results do not depend on how
+	the tasks are scheduled.
+*/
+
+import (
+	"math/rand/v2"
+	"slices"
+
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+const default_seed2 = 97 // second word of the PCG seed
+
+// The master random number generator seeded by s.Seed.
+func (s *Setting) Rand() *rand.Rand {
+	if s.rng == nil {
+		s.pcg = rand.NewPCG(s.Seed, default_seed2)
+		s.rng = rand.New(s.pcg)
+	}
+	return s.rng
+}
+
+// Set the seed and reset the master stream.
+func (s *Setting) SetSeed(seed uint64) {
+	s.Seed = seed
+	s.rng = nil
+	s.Rand()
+}
+
+// State of the master stream (for checkpoints).
+func (s *Setting) RandState() []byte {
+	s.Rand()
+	state, err := s.pcg.MarshalBinary()
+	JustFail(err)
+	return state
+}
+
+func (s *Setting) SetRandState(state []byte) {
+	s.Rand()
+	JustFail(s.pcg.UnmarshalBinary(state))
+}
+
+// Independent streams for n tasks, drawn from the master stream.
+func (s *Setting) NewStreams(n int) []*rand.Rand {
+	master := s.Rand()
+	rngs := make([]*rand.Rand, n)
+	for i := range rngs {
+		rngs[i] = rand.New(rand.NewPCG(master.Uint64(), master.Uint64()))
+	}
+	return rngs
+}
+
+// n distinct integers from [0, m) by Floyd's algorithm, without permuting
+// all of [0, m); n is capped at m. Every subset is equally likely, but the
+// order of the integers is not random.
+func SampleDistinct(rng *rand.Rand, m, n int) []int {
+	n = min(n, m)
+	ps := make([]int, 0, n)
+	var picked map[int]bool // for large n; otherwise ps is searched
+	if n > 32 {
+		picked = make(map[int]bool, n)
+	}
+	for j := m - n; j < m; j++ {
+		t := rng.IntN(j + 1)
+		if picked != nil {
+			if picked[t] {
+				t = j
+			}
+			picked[t] = true
+		} else if slices.Contains(ps, t) {
+			t = j
+		}
+		ps = append(ps, t)
+	}
+	return ps
+}
+
+// gonum's distributions take a golang.org/x/exp/rand.Source.
+type distSource struct {
+	*rand.Rand
+}
+
+func (distSource) Seed(uint64) {}
+
+// Poisson random number
+func Poisson(rng *rand.Rand, lambda float64) int {
+	dist := distuv.Poisson{Lambda: lambda, Src: distSource{rng}}
+	return int(dist.Rand())
+}
@@ -0,0 +1,107 @@
+package multicell
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+)
+
+/*
+	Genetic robustness and environmental canalization.
+
+	An individual is developed without cue noise (the reference), then
+	k times with a mutated genome (Genome.Mutate, i.e., SpMat.Mutate of
+	every matrix) and k times with a noisy cue (NoisyCue, i.e.,
+	Environment.AddNoise). Each perturbation is measured by the RMS
+	change of the phenotype and the absolute change of Align from the
+	reference, averaged over the k realizations.
+*/
+
+type Robustness struct {
+	GenPheno float64 // phenotypic change by mutations
+	GenAlign float64 // change of Align by mutations
+	EnvPheno float64 // phenotypic change by cue noise
+	EnvAlign float64 // change of Align by cue noise
+}
+
+// Setting without cue noise.
+func (s *Setting) noiseless() *Setting {
+	sq := *s
+	sq.EnvNoise = 0
+	sq.CueSD = 0
+	sq.CueNoise = nil
+	return &sq
+}
+
+func rmsDiff(v0, v1 Vec) float64 {
+	d := make(Vec, len(v0))
+	d.Diff(v0, v1)
+	return d.Norm2() / math.Sqrt(float64(len(d)))
+}
+
+// Robustness of indiv's genome with k realizations of each perturbation.
+func (indiv *Individual) Robustness(rng *rand.Rand, s *Setting, env Environment, k int) Robustness {
+	sq := s.noiseless()
+	develop := func(g Genome, cue Environment) Individual {
+		kid := sq.NewIndividual(rng, indiv.Id, env)
+		kid.Genome = g
+		kid.DevelopCue(rng, sq, env, cue)
+		return kid
+	}
+	ref := develop(indiv.Genome, env)
+	p0 := ref.PhenotypeVec(s)
+
+	var rob Robustness
+	for range k {
+		g := indiv.Genome.Clone()
+		g.Mutate(rng, s)
+		mut := develop(g, env)
+		rob.GenPheno += rmsDiff(mut.PhenotypeVec(s), p0)
+		rob.GenAlign += math.Abs(mut.Align - ref.Align)
+
+		noisy := develop(indiv.Genome, s.NoisyCue(rng, env))
+		rob.EnvPheno += rmsDiff(noisy.PhenotypeVec(s), p0)
+		rob.EnvAlign += math.Abs(noisy.Align - ref.Align)
+	}
+	fk := float64(k)
+	rob.GenPheno /= fk
+	rob.GenAlign /= fk
+	rob.EnvPheno /= fk
+	rob.EnvAlign /= fk
+	return rob
+}
+
+func (pop *Population) Robustness(s *Setting, env Environment, k int) []Robustness {
+	robs := make([]Robustness, len(pop.Indivs))
+	rngs := s.NewStreams(len(pop.Indivs))
+	s.ParallelFor(len(pop.Indivs), func(i int) {
+		robs[i] = pop.Indivs[i].Robustness(rngs[i], s, env, k)
+	})
+	return robs
+}
+
+// Header of the table written by PrintRobustness.
+func PrintRobustnessHeader(fout io.Writer) {
+	fmt.Fprintf(fout, "#%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		"Epoch", "Gen",
+		"GenPheno", "GenPhenoVar", "GenAlign", "GenAlignVar",
+		"EnvPheno", "EnvPhenoVar", "EnvAlign", "EnvAlignVar")
+}
+
+// Means and variances over the population in one line.
+func PrintRobustness(fout io.Writer, iepoch, igen int, robs []Robustness) {
+	cols := make([]Vec, 4)
+	for _, r := range robs {
+		cols[0] = append(cols[0], r.GenPheno)
+		cols[1] = append(cols[1], r.GenAlign)
+		cols[2] = append(cols[2], r.EnvPheno)
+		cols[3] = append(cols[3], r.EnvAlign)
+	}
+	fmt.Fprintf(fout, "%d\t%d", iepoch, igen)
+	for _, col := range cols {
+		ave, sd := avesd(col)
+		fmt.Fprintf(fout, "\t%e\t%e", ave, sd*sd)
+	}
+	fmt.Fprintf(fout, "\n")
+}
@@ -0,0 +1,188 @@
+package multicell
+
+import (
+	"log"
+	"math/rand/v2"
+	"slices"
+	"sort"
+)
+
+// Selection schemes.
+// A Selector picks n parents (indices into fits), in random order
+// as consecutive parents are mated.
+type Selector interface {
+	Select(rng *rand.Rand, fits []float64, n int) []int
+}
+
+// Selection schemes by name. The parameter (Setting.SelParam) is
+// scheme-specific; 0 means the default value.
+var selectors = map[string]func(param float64) Selector{
+	"Rejection":    func(_ float64) Selector { return RejectionSelector{} },
+	"WrightFisher": func(_ float64) Selector { return WrightFisherSelector{} },
+	"Tournament": func(p float64) Selector {
+		return TournamentSelector{Size: int(paramOr(p, 2))}
+	},
+	"Truncation": func(p float64) Selector {
+		return TruncationSelector{Fraction: paramOr(p, 0.5)}
+	},
+	"Rank": func(p float64) Selector {
+		return RankSelector{Pressure: paramOr(p, 1.5)}
+	},
+	"MuLambda": func(p float64) Selector {
+		return MuLambdaSelector{Mu: int(paramOr(p, 100))}
+	},
+}
+
+// Policies when all individuals have zero fitness.
+const (
+	ExtinctionDrift = "Drift" // select uniformly at random (neutral drift)
+	ExtinctionAbort = "Abort" // stop the simulation
+)
+
+func paramOr(p, def float64) float64 {
+	if p > 0 {
+		return p
+	}
+	return def
+}
+
+func (s *Setting) GetSelector() Selector {
+	name := s.Selection
+	if name == "" {
+		name = "Rejection"
+	}
+	f, ok := selectors[name]
+	if !ok {
+		log.Fatal("Unknown selection scheme: " + name)
+	}
+	sel := f(s.SelParam)
+	// weights of the worst would be negative above 2
+	if rs, ok := sel.(RankSelector); ok && (rs.Pressure < 1 || rs.Pressure > 2) {
+		log.Fatalf("Rank selection: pressure %g not in [1, 2]\n", rs.Pressure)
+	}
+	return sel
+}
+
+// Rejection sampling proportional to Fitness/max(Fitness).
+type RejectionSelector struct{}
+
+func (RejectionSelector) Select(rng *rand.Rand, fits []float64, n int) []int {
+	maxfit := slices.Max(fits)
+	var parents []int
+	for len(parents) < n {
+		i := rng.IntN(len(fits))
+		if rng.Float64() < fits[i]/maxfit {
+			parents = append(parents, i)
+		}
+	}
+	return parents
+}
+
+// Multinomial sampling with probabilities proportional to weights.
+func sampleMultinomial(rng *rand.Rand, weights []float64, n int) []int {
+	cum := make([]float64, len(weights))
+	tot := 0.0
+	for i, w := range weights {
+		tot += w
+		cum[i] = tot
+	}
+	parents := make([]int, n)
+	for k := range parents {
+		r := rng.Float64() * tot
+		parents[k] = sort.Search(len(cum), func(i int) bool {
+			return cum[i] > r
+		})
+	}
+	return parents
+}
+
+// Wright-Fisher: multinomial sampling proportional to fitness.
+type WrightFisherSelector struct{}
+
+func (WrightFisherSelector) Select(rng *rand.Rand, fits []float64, n int) []int {
+	return sampleMultinomial(rng, fits, n)
+}
+
+// The fittest of Size individuals picked at random.
+type TournamentSelector struct {
+	Size int
+}
+
+func (ts TournamentSelector) Select(rng *rand.Rand, fits []float64, n int) []int {
+	parents := make([]int, n)
+	for k := range parents {
+		best := rng.IntN(len(fits))
+		for range ts.Size - 1 {
+			if i := rng.IntN(len(fits)); fits[i] > fits[best] {
+				best = i
+			}
+		}
+		parents[k] = best
+	}
+	return parents
+}
+
+// indices sorted by descending fitness (ties by index).
+func rankByFitness(fits []float64) []int {
+	idx := make([]int, len(fits))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return fits[idx[a]] > fits[idx[b]]
+	})
+	return idx
+}
+
+// Uniform sampling among the top Fraction of the population.
+type TruncationSelector struct {
+	Fraction float64
+}
+
+func (ts TruncationSelector) Select(rng *rand.Rand, fits []float64, n int) []int {
+	ranked := rankByFitness(fits)
+	ntop := max(1, min(len(fits), int(ts.Fraction*float64(len(fits)))))
+	parents := make([]int, n)
+	for k := range parents {
+		parents[k] = ranked[rng.IntN(ntop)]
+	}
+	return parents
+}
+
+// Linear ranking with selection pressure in [1, 2]:
+// the best is chosen Pressure times, the worst 2-Pressure times, on average.
+type RankSelector struct {
+	Pressure float64
+}
+
+func (rs RankSelector) Select(rng *rand.Rand, fits []float64, n int) []int {
+	ranked := rankByFitness(fits)
+	np := float64(len(fits))
+	weights := make([]float64, len(fits))
+	for r, i := range ranked {
+		x := 0.0 // 0 for the best, 1 for the worst
+		if len(fits) > 1 {
+			x = float64(r) / (np - 1)
+		}
+		weights[i] = rs.Pressure - 2*(rs.Pressure-1)*x
+	}
+	return sampleMultinomial(rng, weights, n)
+}
+
+// (mu, lambda): the Mu fittest have equal numbers of offspring.
+type MuLambdaSelector struct {
+	Mu int
+}
+
+func (ms MuLambdaSelector) Select(rng *rand.Rand, fits []float64, n int) []int {
+	ranked := rankByFitness(fits)
+	mu := max(1, min(len(fits), ms.Mu))
+	parents := make([]int, n)
+	for k := range parents {
+		parents[k] = ranked[k%mu]
+	}
+	rng.Shuffle(n, func(i, j int) {
+		parents[i], parents[j] = parents[j], parents[i]
+	})
+	return parents
+}
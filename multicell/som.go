@@ -1,5 +1,10 @@
 package multicell
 
+import (
+	"maps"
+	"slices"
+)
+
 // sparse matrix of anything.
 type SliceOfMaps[T any] struct {
 	M []map[int]T
@@ -29,6 +34,16 @@ func (sm SliceOfMaps[T]) Do(f func(i, j int, v T)) {
 	}
 }
 
+// Same as Do but in the ascending order of (i, j).
+// Use this when f consumes random numbers or accumulates floats.
+func (sm SliceOfMaps[T]) DoOrdered(f func(i, j int, v T)) {
+	for i, mi := range sm.M {
+		for _, j := range slices.Sorted(maps.Keys(mi)) {
+			f(i, j, mi[j])
+		}
+	}
+}
+
 func (sm SliceOfMaps[T]) EachRow(f func(i int, mi map[int]T)) {
 	for i, mi := range sm.M {
 		f(i, mi)
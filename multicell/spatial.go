@@ -0,0 +1,125 @@
+package multicell
+
+import (
+	"log"
+)
+
+/*
+	Spatial environments (Setting.SpatialEnv).
+
+	A uniform environment has one segment of length LenFace per face
+	direction, shared by all the cells on that side of the individual.
+	A spatial environment has one segment for each boundary face of
+	each cell, in the order of cell Id and face, so that every position
+	on the boundary has its own cue and selection target.
+*/
+
+// Spatial environment patterns for NewSpatialEnvironment.
+var spatialPatterns = []string{"Edges", "Gradient", "Random"}
+
+// Number of faces not facing another cell.
+func (s *Setting) NumBoundaryFaces() int {
+	n := 0
+	for _, offs := range s.layout().boundary {
+		for _, k := range offs {
+			if k >= 0 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Length of an environment.
+func (s *Setting) LenEnv() int {
+	if s.SpatialEnv {
+		return s.LenFace * s.NumBoundaryFaces()
+	}
+	return s.LenFace * s.NumCellFaces()
+}
+
+// Segment of env for each (cell Id, face) on the boundary;
+// nil for the faces facing another cell.
+func (s *Setting) BoundaryEnv(env Environment) [][]Vec {
+	boundary := s.layout().boundary
+	benv := make([][]Vec, len(boundary))
+	for id, offs := range boundary {
+		benv[id] = make([]Vec, len(offs))
+		for iface := range offs {
+			benv[id][iface] = s.boundarySegment(env, id, iface)
+		}
+	}
+	return benv
+}
+
+// Segment of env for face iface of cell id (nil if facing another cell),
+// without the allocations of BoundaryEnv.
+func (s *Setting) boundarySegment(env Environment, id, iface int) Vec {
+	k := s.layout().boundary[id][iface]
+	if k < 0 {
+		return nil
+	}
+	return env[k : k+s.LenFace]
+}
+
+// Spatial environment with the faces of a uniform environment
+// (a condition for each edge of the individual).
+func (env Environment) Spatialize(s *Setting) Environment {
+	var senv Environment
+	for _, fc := range s.LatticeFacing() {
+		for iface, iop := range fc {
+			if iop < 0 {
+				senv = append(senv, env.Face(s, iface)...)
+			}
+		}
+	}
+	return senv
+}
+
+// Spatial environment of a pattern:
+// "Edges": the faces of NewEnvironment;
+// "Gradient": a morphogen-like gradient along the x-axis, with the fraction of
+// +1 in a face increasing with the position of the cell;
+// "Random": random -1 or +1.
+func (s *Setting) NewSpatialEnvironment(pattern string) Environment {
+	if !s.SpatialEnv {
+		log.Fatal("NewSpatialEnvironment: SpatialEnv is not set")
+	}
+	switch pattern {
+	case "Edges":
+		ss := *s
+		ss.SpatialEnv = false
+		return ss.NewEnvironment().Spatialize(s)
+	case "Gradient":
+		var env Environment
+		for id, fc := range s.LatticeFacing() {
+			x := (float64(id/s.NumCellY) + 0.5) / float64(s.NumCellX)
+			npos := int(x*float64(s.LenFace) + 0.5)
+			for _, iop := range fc {
+				if iop >= 0 {
+					continue
+				}
+				for k := range s.LenFace {
+					if k < npos {
+						env = append(env, 1)
+					} else {
+						env = append(env, -1)
+					}
+				}
+			}
+		}
+		return env
+	case "Random":
+		env := NewVec(s.LenEnv(), 1.0)
+		rng := s.Rand()
+		for i := range env {
+			if rng.IntN(2) == 0 {
+				env[i] = -1
+			}
+		}
+		return env
+	default:
+		log.Fatalf("Unknown spatial pattern %s (one of %v)\n", pattern, spatialPatterns)
+	}
+	return nil
+}
@@ -4,8 +4,7 @@ import (
 	"log"
 	"maps"
 	"math/rand/v2"
-
-	"gonum.org/v1/gonum/stat/distuv"
+	"slices"
 )
 
 // sparse matrix
@@ -50,10 +49,68 @@ func (sp *SpMat) Clone() SpMat {
 }
 
 // multiply a sparse matrix to a vector. vout is NOT initialized!!
+// Columns are summed in ascending order so that the result is reproducible.
 func (vout Vec) MultSpMatVec(sp SpMat, vin Vec) {
-	sp.Do(func(i, j int, x float64) {
-		vout[i] += x * vin[j]
-	})
+	var buf [32]int
+	for i, mi := range sp.M {
+		js := buf[:0]
+		for j := range mi {
+			js = append(js, j)
+		}
+		slices.Sort(js)
+		for _, j := range js {
+			vout[i] += mi[j] * vin[j]
+		}
+	}
+}
+
+// Sparse matrix in the compressed sparse row format (for development).
+// The columns of each row are in ascending order, as in MultSpMatVec.
+type CSRMat struct {
+	Ncol   int
+	RowPtr []int // row i is in [RowPtr[i], RowPtr[i+1])
+	ColIdx []int
+	Val    []float64
+}
+
+func (sp SpMat) ToCSR() CSRMat {
+	var csr CSRMat
+	sp.toCSRInto(&csr)
+	return csr
+}
+
+// ToCSR reusing the storage of csr.
+func (sp SpMat) toCSRInto(csr *CSRMat) {
+	csr.Ncol = sp.Ncol
+	csr.RowPtr = append(csr.RowPtr[:0], 0)
+	csr.ColIdx = csr.ColIdx[:0]
+	csr.Val = csr.Val[:0]
+	for _, mi := range sp.M {
+		p := len(csr.ColIdx)
+		for j := range mi {
+			csr.ColIdx = append(csr.ColIdx, j)
+		}
+		slices.Sort(csr.ColIdx[p:])
+		for _, j := range csr.ColIdx[p:] {
+			csr.Val = append(csr.Val, mi[j])
+		}
+		csr.RowPtr = append(csr.RowPtr, len(csr.ColIdx))
+	}
+}
+
+func (csr CSRMat) Nrows() int {
+	return len(csr.RowPtr) - 1
+}
+
+// Same as MultSpMatVec. vout is NOT initialized!!
+func (vout Vec) MultCSRVec(csr CSRMat, vin Vec) {
+	for i := range csr.Nrows() {
+		v := vout[i]
+		for p := csr.RowPtr[i]; p < csr.RowPtr[i+1]; p++ {
+			v += csr.Val[p] * vin[csr.ColIdx[p]]
+		}
+		vout[i] = v
+	}
 }
 
 func (sp *SpMat) ToVec() Vec {
@@ -76,26 +133,28 @@ func (sp SpMat) Density() float64 {
 	return nonz / float64(sp.Nrows()*sp.Ncols())
 }
 
-func (sp SpMat) PickRandomElements(n int) SliceOfMaps[float64] {
-	nr := sp.Nrows()
+func (sp SpMat) PickRandomElements(rng *rand.Rand, n int) SliceOfMaps[float64] {
+	ps := NewSliceOfMaps[float64](sp.Nrows())
+	sp.eachRandomElement(rng, n, func(i, j int, r float64) {
+		ps.M[i][j] = r
+	})
+	return ps
+}
+
+// Call f(i, j, r) for n distinct random elements (i, j) with uniform random numbers r.
+func (sp SpMat) eachRandomElement(rng *rand.Rand, n int, f func(i, j int, r float64)) {
 	nc := sp.Ncols()
-	ps := NewSliceOfMaps[float64](nr)
-	for _, p := range rand.Perm(nr * nc)[:n] {
-		i := p / nc
-		j := p % nc
-		ps.M[i][j] = rand.Float64()
+	for _, p := range SampleDistinct(rng, sp.Nrows()*nc, n) {
+		f(p/nc, p%nc, rng.Float64())
 	}
-
-	return ps
 }
 
 // random matrix
-func (sp SpMat) Randomize(density float64) {
+func (sp SpMat) Randomize(rng *rand.Rand, density float64) {
 	nr := sp.Nrows()
 	nc := sp.Ncols()
-	dist := distuv.Poisson{Lambda: density * float64(nr*nc)}
-	n := int(dist.Rand())
-	sp.PickRandomElements(n).Do(func(i, j int, r float64) {
+	n := Poisson(rng, density*float64(nr*nc))
+	sp.eachRandomElement(rng, n, func(i, j int, r float64) {
 		if r < 0.5 {
 			sp.M[i][j] = 1
 		} else {
@@ -111,13 +170,12 @@ func (sp SpMat) ScaleBy(scale float64) SpMat {
 	return sp
 }
 
-func (sp SpMat) Mutate(rate float64, density float64) {
+func (sp SpMat) Mutate(rng *rand.Rand, rate float64, density float64) {
 	nr := sp.Nrows()
 	nc := sp.Ncols()
-	dist := distuv.Poisson{Lambda: rate * float64(nr*nc)}
-	n := int(dist.Rand())
+	n := Poisson(rng, rate*float64(nr*nc))
 	d2 := density / 2
-	sp.PickRandomElements(n).Do(func(i, j int, r float64) {
+	sp.eachRandomElement(rng, n, func(i, j int, r float64) {
 		if r >= density {
 			delete(sp.M[i], j)
 		} else {
@@ -136,7 +194,7 @@ func (sp SpMat) Mutate(rate float64, density float64) {
 	})
 }
 
-func (mat0 SpMat) MateWith(mat1 SpMat) (SpMat, SpMat) {
+func (mat0 SpMat) MateWith(rng *rand.Rand, mat1 SpMat) (SpMat, SpMat) {
 	if mat0.Nrows() != mat1.Nrows() || mat0.Ncols() != mat1.Ncols() {
 		log.Fatal("MateSpMats: incompatible matrices")
 	}
@@ -145,7 +203,7 @@ func (mat0 SpMat) MateWith(mat1 SpMat) (SpMat, SpMat) {
 	nmat1 := NewSpMat(mat0.Nrows(), mat0.Ncols())
 
 	for i := range mat0.Nrows() {
-		if rand.IntN(2) == 1 {
+		if rng.IntN(2) == 1 {
 			nmat0.M[i] = maps.Clone(mat0.M[i])
 			nmat1.M[i] = maps.Clone(mat1.M[i])
 		} else {
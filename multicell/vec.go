@@ -155,17 +155,17 @@ func CorrVecs(vs0, vs1 Vec) (float64, float64) {
 	}
 	r := corr / math.Sqrt(v0*v1)
 	tstat := r * math.Sqrt((f-2)/(1-r*r))
-	dist := distuv.StudentsT{0, 1, f - 2, nil}
+	dist := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: f - 2}
 	pval := 2 * dist.CDF(-math.Abs(tstat))
 	return r, pval
 }
 
-func (vec Vec) Mutate(rate float64) {
+func (vec Vec) Mutate(rng *rand.Rand, rate float64) {
 	for i, v := range vec {
-		if rand.Float64() >= rate {
+		if rng.Float64() >= rate {
 			continue
 		}
-		r := rand.IntN(2)
+		r := rng.IntN(2)
 		if v == 0.0 {
 			if r == 0 {
 				vec[i] = 1.0
@@ -180,11 +180,20 @@ func (vec Vec) Mutate(rate float64) {
 	}
 }
 
-func (vec0 Vec) MateWith(vec1 Vec) (Vec, Vec) {
+// Gaussian perturbations of standard deviation sd at rate.
+func (vec Vec) MutateGauss(rng *rand.Rand, rate, sd float64) {
+	for i := range vec {
+		if rng.Float64() < rate {
+			vec[i] += sd * rng.NormFloat64()
+		}
+	}
+}
+
+func (vec0 Vec) MateWith(rng *rand.Rand, vec1 Vec) (Vec, Vec) {
 	nvec0 := vec0.Clone()
 	nvec1 := vec1.Clone()
 	for i, v0 := range vec0 {
-		if rand.IntN(2) == 0 {
+		if rng.IntN(2) == 0 {
 			nvec0[i] = vec1[i]
 			nvec1[i] = v0
 		}
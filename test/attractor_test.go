@@ -0,0 +1,67 @@
+package multicell_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+// A single-layer loop x -> CStep1(w * f(x)) with a diagonal w.
+func loopIndividual(s *multicell.Setting, w float64) multicell.Individual {
+	env := s.NewEnvironment()
+	indiv := s.NewIndividual(s.Rand(), 0, env)
+	indiv.Genome = s.NewGenome()
+	n := s.LenLayer[0]
+	mat := multicell.NewSpMat(n, n)
+	for i := range n {
+		mat.M[i][i] = w
+	}
+	indiv.Genome.M[1][0] = mat
+	return indiv
+}
+
+func TestAttractor(t *testing.T) {
+	s := multicell.GetDefaultSetting("NullDev")
+	env := s.NewEnvironment()
+
+	indiv := loopIndividual(s, 10)
+	att := indiv.Attractor(s.Rand(), s, env)
+	if att.Kind != "Fixed" || att.Period != 1 {
+		t.Errorf("positive loop: %s with period %d; want a fixed point", att.Kind, att.Period)
+	}
+	if att.SpectralRadius > 1e-6 || att.Lyapunov >= 0 {
+		t.Errorf("saturated fixed point: spectral radius %e, Lyapunov %e", att.SpectralRadius, att.Lyapunov)
+	}
+
+	indiv = loopIndividual(s, -10)
+	att = indiv.Attractor(s.Rand(), s, env)
+	if att.Kind != "Cycle" || att.Period != 2 {
+		t.Errorf("negative loop: %s with period %d; want a 2-cycle", att.Kind, att.Period)
+	}
+
+	fixed := loopIndividual(s, 10)
+	stats := multicell.GetAttractorStats([]multicell.Attractor{
+		fixed.Attractor(s.Rand(), s, env), att})
+	if stats.Nfixed != 1 || stats.Ncycle != 1 || stats.Period != 2 {
+		t.Errorf("unexpected summary: %+v", stats)
+	}
+	if empty := multicell.GetAttractorStats(nil); !math.IsNaN(empty.Lyapunov) || empty.Nfixed != 0 {
+		t.Errorf("unexpected summary of no individuals: %+v", empty)
+	}
+}
+
+func TestAttractorRandom(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	env := s.NewEnvironment()
+	indiv := s.NewIndividual(s.Rand(), 0, env)
+	indiv.Genome = s.NewGenome()
+	indiv.Develop(s.Rand(), s, env)
+	att := indiv.Attractor(s.Rand(), s, env)
+	if indiv.Fitness > 0 && att.Kind != "Fixed" {
+		t.Errorf("converged development classified as %s", att.Kind)
+	}
+	if att.Kind == "Fixed" && att.SpectralRadius >= 1 {
+		t.Errorf("unstable fixed point: spectral radius %f", att.SpectralRadius)
+	}
+}
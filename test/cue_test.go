@@ -0,0 +1,81 @@
+package multicell_test
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+func TestPredictorEnv(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.LenFace = 4096
+	s.CueRel = multicell.Vec{1, 0, -1, 0.5}
+	s.CheckCues()
+	env := s.NewEnvironment()
+	pred := s.PredictorEnv(s.Rand(), env)
+	for iface, r := range s.CueRel {
+		c := multicell.DotVecs(env.Face(s, iface), pred.Face(s, iface)) / float64(s.LenFace)
+		if math.Abs(c-r) > 0.05 {
+			t.Errorf("face %d: correlation %f; want %f", iface, c, r)
+		}
+	}
+
+	s.ContinuousEnv = true
+	env = s.NewContinuousEnvironment()
+	pred = s.PredictorEnv(s.Rand(), env)
+	for iface, r := range s.CueRel {
+		c, _ := multicell.CorrVecs(env.Face(s, iface), pred.Face(s, iface))
+		if math.Abs(c-r) > 0.05 {
+			t.Errorf("continuous face %d: correlation %f; want %f", iface, c, r)
+		}
+	}
+}
+
+func TestCueNoise(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.CueNoise = multicell.Vec{0, 0.5, 0, 0}
+	env := s.NewEnvironment()
+	cue := s.NoisyCue(s.Rand(), env)
+	for iface := range multicell.NumFaces {
+		same := slices.Equal(cue.Face(s, iface), env.Face(s, iface))
+		if same != (iface != 1) {
+			t.Errorf("face %d: noise %f, but the cue is the same: %t", iface, s.CueNoise[iface], same)
+		}
+	}
+}
+
+func TestCueLag(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.CueLag = 2
+	envs := multicell.GetEnvGenerator("Hamming")(s, s.NewEnvironment(), 4, 0)
+	var pop multicell.Population
+	for igen, env := range envs {
+		pop.Env = env
+		cue := pop.CueSource(s, env)
+		want := envs[max(0, igen-s.CueLag)]
+		if !slices.Equal(cue, want) {
+			t.Errorf("generation %d: cue is not from generation %d", igen, max(0, igen-s.CueLag))
+		}
+		pop.PushEnvHist(s)
+	}
+}
+
+func TestMisleadingCue(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.Outdir = "traj"
+	s.MaxPopulation = 10
+	s.MaxGeneration = 2
+	s.EnvNoise = 0
+	s.CueRel = multicell.Vec{-1, -1, -1, -1}
+	envs := s.SaveEnvs(ENVSFILE, 2)
+	pop := s.NewPopulation(envs[0])
+	pop, _ = pop.Evolve(s, envs[1])
+	for _, indiv := range pop.Indivs {
+		cue := indiv.CueVec(s)
+		if multicell.DotVecs(cue, envs[1]) != -float64(envs[1].Len()) {
+			t.Fatalf("cue is not the opposite of the environment")
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package multicell_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+func TestDevCue(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.EnvNoise = 0
+	s.DevCueStep = 5
+	s.DevCueLen = 3
+	env := s.SaveEnvs(ENVSFILE, 2)[1]
+	alt := s.AltEnv(env, 0)
+	g := s.NewGenome()
+	for _, mode := range []string{"Fixed", "Switch", "Pulse", "Ramp", "Resample"} {
+		s.DevCue = mode
+		indiv := s.NewIndividual(s.Rand(), 0, env)
+		indiv.Genome = g
+		indiv.Develop(s.Rand(), s, env)
+		cue := indiv.CueVec(s)
+		want := env
+		if mode == "Switch" || mode == "Ramp" {
+			want = alt
+			if indiv.Ndev <= s.DevCueStep {
+				t.Errorf("%s: development stopped at %d", mode, indiv.Ndev)
+			}
+		}
+		if !slices.Equal(cue, want) {
+			t.Errorf("%s: unexpected cue at the end of development", mode)
+		}
+	}
+}
+
+func TestAltEnvAllBlocks(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.Denv = 2
+	env := s.NewEnvironment()
+	alt := s.AltEnv(env, 0)
+	for i := range env {
+		if alt[i] != -env[i] {
+			t.Fatalf("element %d not flipped with Denv = %g", i, s.Denv)
+		}
+	}
+}
+
+func TestDevRecord(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.DevRecord = []int{1, 5, s.MaxDevelop}
+	env := s.SaveEnvs(ENVSFILE, 2)[1]
+	indiv := s.NewIndividual(s.Rand(), 0, env)
+	indiv.Genome = s.NewGenome()
+	indiv.Develop(s.Rand(), s, env)
+	if len(indiv.DevPheno) != len(s.DevRecord) {
+		t.Fatalf("%d phenotypes recorded; want %d", len(indiv.DevPheno), len(s.DevRecord))
+	}
+	if !slices.Equal(indiv.DevPheno[2], indiv.PhenotypeVec(s)) {
+		t.Errorf("the last recorded phenotype is not the final one")
+	}
+	if slices.Equal(indiv.DevPheno[0], indiv.DevPheno[1]) {
+		t.Errorf("the phenotype did not change from step 1 to 5")
+	}
+}
@@ -0,0 +1,81 @@
+package multicell_test
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+func TestDevTraj(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	env := s.SaveEnvs(ENVSFILE, 2)[1]
+	indiv := s.NewIndividual(s.Rand(), 0, env)
+	indiv.Genome = s.NewGenome()
+	rec := s.NewDevRecorder(len(indiv.Cells))
+	indiv.DevelopRecord(s.Rand(), s, env, rec)
+	if len(rec.Rows) != indiv.Ndev+1 {
+		t.Fatalf("%d rows recorded; want %d", len(rec.Rows), indiv.Ndev+1)
+	}
+	ncol := 1
+	for _, l := range s.LenLayer {
+		ncol += len(indiv.Cells) * l
+	}
+	var last multicell.Vec
+	for _, c := range indiv.Cells {
+		for _, sl := range c.S {
+			last = append(last, sl...)
+		}
+	}
+	if len(rec.Rows[0]) != ncol || !math.IsNaN(rec.Rows[0][0]) {
+		t.Errorf("bad initial row")
+	}
+	if !slices.Equal(rec.Rows[indiv.Ndev][1:], last) {
+		t.Errorf("the last row is not the final state")
+	}
+
+	file := "traj/devtraj_test.npy"
+	multicell.SaveNPY(file, rec.Rows[1:])
+	rows := multicell.LoadNPY(file)
+	if len(rows) != indiv.Ndev {
+		t.Fatalf("%d rows loaded; want %d", len(rows), indiv.Ndev)
+	}
+	for i, row := range rows {
+		if !slices.Equal(row, rec.Rows[i+1]) {
+			t.Errorf("row %d differs after loading", i)
+		}
+	}
+}
+
+func TestEvolveRecordDev(t *testing.T) {
+	evolve := func(record []int) multicell.Population {
+		s := multicell.GetDefaultSetting("Full")
+		s.Outdir = "traj"
+		s.Basename = "recorddev"
+		s.MaxPopulation = 10
+		s.MaxGeneration = 2
+		s.RecordDev = record
+		envs := s.SaveEnvs(ENVSFILE, 2)
+		pop := s.NewPopulation(envs[0])
+		pop1, _ := pop.Evolve(s, envs[1])
+		return pop1
+	}
+	pop0 := evolve(nil)
+	pop1 := evolve([]int{0, 3})
+	for i, indiv := range pop1.Indivs {
+		if indiv.Fitness != pop0.Indivs[i].Fitness {
+			t.Fatalf("recording changed the fitness of %d", i)
+		}
+	}
+	for _, indiv := range pop1.Indivs {
+		if indiv.Id != 0 && indiv.Id != 3 {
+			continue
+		}
+		file := fmt.Sprintf("traj/recorddev_%2.2d_%3.3d.dev%d.npy", pop1.Iepoch, pop1.Igen, indiv.Id)
+		if rows := multicell.LoadNPY(file); len(rows) != indiv.Ndev+1 {
+			t.Errorf("%s: %d rows; want %d", file, len(rows), indiv.Ndev+1)
+		}
+	}
+}
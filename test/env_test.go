@@ -1,7 +1,12 @@
 package multicell_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/arkinjo/evodevo3/multicell"
@@ -32,7 +37,11 @@ func TestEnvCue(t *testing.T) {
 	envs := s.SaveEnvs(ENVSFILE, 50)
 	s.LenBlock = 5
 	env := envs[1]
-	cue := env.AddNoise(s.EnvNoise)
+	// the number of flips is the first draw of AddNoise
+	state := s.RandState()
+	nexp := multicell.Poisson(s.Rand(), s.EnvNoise*float64(len(env)))
+	s.SetRandState(state)
+	cue := env.AddNoise(s.Rand(), s.EnvNoise)
 
 	ndiff := 0
 	for i, v := range cue {
@@ -45,8 +54,6 @@ func TestEnvCue(t *testing.T) {
 			fmt.Printf("env/cue: %d %2.0f %2.0f\n", i, e, cue[i])
 		}
 	}
-	nexp := s.LenBlock
-
 	if ndiff != nexp {
 		t.Errorf("Cue difference %d; expected %d\n", ndiff, nexp)
 	}
@@ -64,3 +71,197 @@ func TestEnvironment(t *testing.T) {
 		}
 	}
 }
+
+func TestEnvDynamics(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.Outdir = "traj"
+	s.EnvPeriod = 4
+	env := s.SaveEnvs(ENVSFILE, 2)[1]
+	nblk := env.Len() / s.LenBlock
+	for _, name := range []string{"Static", "BlockFlipNR", "BlockFlip", "Markov", "Periodic", "RedNoise"} {
+		s.EnvDynamics = name
+		dyn := s.GetEnvDynamics()
+		pop := multicell.Population{Env: env}
+		nchange := 0
+		for igen := range 40 {
+			pop.Igen = igen
+			nenv := dyn.Next(s, &pop, env)
+			if nenv.Len() != env.Len() {
+				t.Fatalf("%s: environment of length %d", name, nenv.Len())
+			}
+			d := nenv.Compare(env)
+			if d != 0 {
+				nchange++
+			}
+			if name == "Periodic" && (d == 0) != ((igen+1)%4 < 2) {
+				t.Errorf("Periodic: distance %f at generation %d", d, igen+1)
+			}
+			pop.Env = nenv
+		}
+		if (name == "Static") != (nchange == 0) {
+			t.Errorf("%s: changed %d times in 40 generations", name, nchange)
+		}
+		if name == "RedNoise" && len(pop.EnvState) != nblk {
+			t.Errorf("RedNoise: state of length %d; want %d", len(pop.EnvState), nblk)
+		}
+	}
+
+	// more flips than blocks are capped
+	s.EnvDynamics = "BlockFlip"
+	s.Penv01 = 1
+	dyn := s.GetEnvDynamics()
+	pop := multicell.Population{Env: env}
+	for range 40 {
+		pop.Env = dyn.Next(s, &pop, env)
+	}
+}
+
+func TestEnvLog(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.Outdir = "traj"
+	s.MaxPopulation = 10
+	s.MaxGeneration = 4
+	s.EnvDynamics = "Markov"
+	envs := s.SaveEnvs(ENVSFILE, 2)
+	pop := s.NewPopulation(envs[0])
+	pop.Iepoch = 1
+	pop.Evolve(s, envs[1])
+
+	buffer, err := os.ReadFile(s.EnvLogFilename(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(buffer)), "\n")
+	if len(lines) != s.MaxGeneration {
+		t.Fatalf("%d lines in the environment log; want %d", len(lines), s.MaxGeneration)
+	}
+	for igen, line := range lines {
+		var env multicell.Environment
+		var jgen int
+		var d float64
+		fields := strings.Split(line, "\t")
+		fmt.Sscan(fields[0], &jgen)
+		fmt.Sscan(fields[1], &d)
+		if err := json.Unmarshal([]byte(fields[2]), &env); err != nil {
+			t.Fatal(err)
+		}
+		if jgen != igen || env.Compare(envs[1]) != d {
+			t.Errorf("environment log: %d %f; want %d %f", jgen, d, igen, env.Compare(envs[1]))
+		}
+	}
+}
+
+func TestEnvGenerators(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	env0 := s.NewEnvironment()
+	nfaces := env0.Len() / s.LenFace
+	nflip := int(s.Denv*float64(s.LenFace/s.LenBlock)) * s.LenBlock * nfaces
+
+	envs := multicell.GetEnvGenerator("Hamming")(s, env0, 10, 0)
+	for i, env := range envs[1:] {
+		if d := int(env.Compare(env0)); d != nflip {
+			t.Errorf("Hamming: env %d at %d from the ancestor; want %d", i+1, d, nflip)
+		}
+	}
+
+	envs = multicell.GetEnvGenerator("Alternating")(s, env0, 6, 0)
+	if !slices.Equal(envs[4], env0) || !slices.Equal(envs[1], envs[5]) || slices.Equal(envs[0], envs[1]) {
+		t.Errorf("Alternating: not alternating")
+	}
+
+	envs = multicell.GetEnvGenerator("Orthogonal")(s, env0, 10, 0)
+	for i, e0 := range envs {
+		for _, e1 := range envs[i+1:] {
+			if d := multicell.DotVecs(e0, e1); d != 0 {
+				t.Errorf("Orthogonal: dot product %f", d)
+			}
+		}
+	}
+
+	corr := 0.6
+	envs = multicell.GetEnvGenerator("Correlated")(s, env0, 100, corr)
+	ave := 0.0
+	npair := 0
+	for i, e0 := range envs[1:] {
+		for _, e1 := range envs[i+2:] {
+			ave += multicell.DotVecs(e0, e1) / float64(e0.Len())
+			npair++
+		}
+	}
+	ave /= float64(npair)
+	if math.Abs(ave-corr) > 0.05 {
+		t.Errorf("Correlated: mean pairwise correlation %f; want %f", ave, corr)
+	}
+	ave = 0.0
+	for _, e := range envs[1:] {
+		ave += multicell.DotVecs(env0, e) / float64(e.Len())
+	}
+	ave /= float64(len(envs) - 1)
+	if math.Abs(ave-math.Sqrt(corr)) > 0.05 {
+		t.Errorf("Correlated: mean correlation with env0 %f; want %f", ave, math.Sqrt(corr))
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	envs := s.SaveEnvs(ENVSFILE, 5)
+	envs1 := s.LoadEnvs(ENVSFILE)
+
+	filename := "traj/envs_old.json"
+	envs.DumpEnvs(filename)
+	envs2 := s.LoadEnvs(filename)
+	for i, env := range envs {
+		if !slices.Equal(env, envs1[i]) || !slices.Equal(env, envs2[i]) {
+			t.Errorf("environment %d differs after loading", i)
+		}
+	}
+
+	var ef multicell.EnvFile
+	buffer, err := os.ReadFile(ENVSFILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buffer, &ef); err != nil {
+		t.Fatal(err)
+	}
+	if ef.Version < 1 || ef.Generator != "BlockWalk" || ef.LenFace != s.LenFace || ef.Seed != s.Seed {
+		t.Errorf("environment file header: %+v", ef.EnvHeader)
+	}
+}
+
+func TestContinuousEnv(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.ContinuousEnv = true
+	s.Denv = 0.1
+	env0 := s.NewContinuousEnvironment()
+	envs := multicell.GetEnvGenerator("GaussWalk")(s, env0, 5, 0)
+	for k, env := range envs {
+		if slices.Min(env) < -1 || slices.Max(env) > 1 {
+			t.Errorf("GaussWalk: env %d out of [-1, 1]", k)
+		}
+		if k > 0 && s.EnvDistance(env, envs[k-1]) == 0 {
+			t.Errorf("GaussWalk: env %d did not change", k)
+		}
+	}
+
+	var d2 float64
+	n := 0
+	for range 100 {
+		cue := s.NoisyCue(s.Rand(), env0)
+		for i, x := range cue {
+			d := x - env0[i]
+			d2 += d * d
+			n++
+		}
+	}
+	if sd := math.Sqrt(d2 / float64(n)); math.Abs(sd-s.CueSD) > 0.01 {
+		t.Errorf("cue noise: SD=%f; want %f", sd, s.CueSD)
+	}
+
+	env1 := env0.Clone()
+	env1[0] += 3
+	env1[1] -= 4
+	if d := s.EnvDistance(env1, env0); math.Abs(d-5) > 1e-12 {
+		t.Errorf("EnvDistance=%f; want 5", d)
+	}
+}
@@ -0,0 +1,134 @@
+package multicell_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+// an individual whose phenotype is exactly the environment.
+func perfectIndividual(s *multicell.Setting, env multicell.Environment) multicell.Individual {
+	indiv := s.NewIndividual(s.Rand(), 0, env)
+	indiv.Genome = s.NewGenome()
+	for i := range indiv.Cells {
+		for iface := range multicell.NumFaces {
+			copy(indiv.Cells[i].Face(s, iface), env.Face(s, iface))
+		}
+	}
+	return indiv
+}
+
+func TestFitnessFuncs(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	env := s.SaveEnvs(ENVSFILE, 2)[1] // not constant within a face (for Corr)
+	for _, metric := range []string{"Dot", "Corr", "Hamming", "MSD"} {
+		for _, ff := range []string{"Exponential", "Gaussian"} {
+			s.AlignMetric = metric
+			s.FitnessFunc = ff
+			s.SelFaces = multicell.Vec{1, 1, 0, 0.5}
+			indiv := perfectIndividual(s, env)
+			indiv.Ndev = s.NdevFree + 10
+			indiv.SetFitness(s, env, 0.0)
+			if indiv.Align != 1 {
+				t.Errorf("%s: Align=%f; want 1", metric, indiv.Align)
+			}
+			want := math.Exp(-10 * s.NdevCost)
+			if math.Abs(indiv.Fitness-want) > 1e-12 {
+				t.Errorf("%s/%s: Fitness=%f; want %f", metric, ff, indiv.Fitness, want)
+			}
+		}
+	}
+}
+
+func TestFitnessFaces(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	env := s.NewEnvironment() // Left, Top = +1; Right, Bottom = -1
+	indiv := perfectIndividual(s, env)
+	indiv.Cells[0].Face(s, multicell.Right).ScaleBy(-1)
+
+	s.SelFaces = multicell.Vec{1, 0, 1, 0}
+	indiv.SetFitness(s, env, 0.0)
+	if indiv.Align != 0 {
+		t.Errorf("Align=%f; want 0", indiv.Align)
+	}
+	s.SelFaces = nil // Left only
+	indiv.SetFitness(s, env, 0.0)
+	if indiv.Align != 1 {
+		t.Errorf("Align=%f; want 1", indiv.Align)
+	}
+}
+
+func TestPlasticityCost(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	env := s.NewEnvironment()
+	indiv := perfectIndividual(s, env)
+	indiv.SetFitness(s, env, 0.0)
+	f0 := indiv.Fitness
+	s.PlastCost = 0.1
+	indiv.SetFitness(s, env, 0.0)
+	want := f0 * math.Exp(-0.1*s.CueSensitivity(indiv.Genome))
+	if s.CueSensitivity(indiv.Genome) <= 0 || math.Abs(indiv.Fitness-want) > 1e-12 {
+		t.Errorf("Fitness=%e; want %e", indiv.Fitness, want)
+	}
+}
+
+func TestFitnessContinuous(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.ContinuousEnv = true
+	env := s.NewContinuousEnvironment()
+	indiv := perfectIndividual(s, env)
+
+	s.AlignMetric = "MSD"
+	indiv.SetFitness(s, env, 0.0)
+	if indiv.Align != 1 {
+		t.Errorf("MSD: Align=%f; want 1", indiv.Align)
+	}
+	// graded: a deviation of 0.2 in every element of the Left face.
+	for i := range indiv.Cells[0].Left(s) {
+		indiv.Cells[0].Left(s)[i] += 0.2
+	}
+	indiv.SetFitness(s, env, 0.0)
+	if want := 1 - 0.2*0.2/2; math.Abs(indiv.Align-want) > 1e-12 {
+		t.Errorf("MSD: Align=%f; want %f", indiv.Align, want)
+	}
+	// MSD is Dot for +/-1 values.
+	env = s.NewEnvironment()
+	indiv = perfectIndividual(s, env)
+	indiv.Cells[0].Left(s)[0] *= -1
+	indiv.SetFitness(s, env, 0.0)
+	a := indiv.Align
+	s.AlignMetric = "Dot"
+	indiv.SetFitness(s, env, 0.0)
+	if a != indiv.Align {
+		t.Errorf("MSD=%f; Dot=%f", a, indiv.Align)
+	}
+}
+
+func TestFitnessConstantTarget(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.AlignMetric = "Corr"
+	env := s.NewEnvironment() // the Left face is constant
+	indiv := perfectIndividual(s, env)
+	indiv.SetFitness(s, env, 0.0)
+	if math.Abs(indiv.Align-1) > 1e-12 {
+		t.Errorf("Corr: Align=%f; want 1", indiv.Align)
+	}
+	indiv.Cells[0].Face(s, multicell.Left).ScaleBy(-1)
+	indiv.SetFitness(s, env, 0.0)
+	if math.Abs(indiv.Align+1) > 1e-12 {
+		t.Errorf("Corr: Align=%f; want -1", indiv.Align)
+	}
+
+	// no boundary face under selection
+	s = multicell.GetDefaultSetting("Full")
+	s.Lattice = "Torus"
+	s.SetModel("Full")
+	s.FitnessFunc = "Gaussian"
+	env = s.NewEnvironment()
+	indiv = perfectIndividual(s, env)
+	indiv.SetFitness(s, env, 0.0)
+	if math.IsNaN(indiv.Align) || math.IsNaN(indiv.Fitness) {
+		t.Errorf("Torus: Align=%f, Fitness=%f", indiv.Align, indiv.Fitness)
+	}
+}
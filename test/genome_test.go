@@ -3,6 +3,8 @@ package multicell_test
 import (
 	"fmt"
 	"math"
+	"math/rand/v2"
+	"slices"
 	"testing"
 
 	"github.com/arkinjo/evodevo3/multicell"
@@ -30,7 +32,7 @@ func TestGenomeClone(t *testing.T) {
 	if !g0.Equal(g1) {
 		t.Errorf("Genome cloning failed.")
 	}
-	g1.M[1][0].Randomize(0.1)
+	g1.M[1][0].Randomize(s.Rand(), 0.1)
 	if g0.M[1][0].Equal(g1.M[1][0]) {
 		t.Errorf("Genome randomization failed (1).")
 	}
@@ -47,7 +49,7 @@ func TestGenomeMutate(t *testing.T) {
 	if !g0.Equal(g1) {
 		t.Errorf("Genome cloning failed")
 	}
-	g1.Mutate(s)
+	g1.Mutate(s.Rand(), s)
 	v0 := g0.ToVec(s)
 	v1 := g1.ToVec(s)
 	dv := make(multicell.Vec, len(v1))
@@ -147,3 +149,62 @@ func TestGenomeKLDiv1(t *testing.T) {
 	}
 
 }
+
+func TestGenomeBias(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.Outdir = "traj"
+	s.MaxPopulation = 20
+	s.MaxGeneration = 5
+	s.WithBias = true
+	s.BiasMutRate = 0.05
+	s.SetSeed(11)
+	envs := s.SaveEnvs(ENVSFILE, 2)
+
+	nvec := 0
+	for l, nl := range s.LenLayer {
+		nvec += nl
+		s.Topology.Do(func(l1, k int, _ float64) {
+			if l1 == l {
+				nvec += nl * s.LenLayer[k]
+			}
+		})
+	}
+	g := s.NewGenome()
+	if n := len(g.ToVec(s)); n != nvec {
+		t.Errorf("genome vector with biases: length %d; want %d", n, nvec)
+	}
+
+	pop := s.NewPopulation(envs[0])
+	pop, _ = pop.Evolve(s, envs[1])
+	nonzero := 0
+	for _, indiv := range pop.Indivs {
+		for _, b := range indiv.Genome.B {
+			for _, x := range b {
+				if x != 0 {
+					nonzero++
+				}
+			}
+		}
+	}
+	if nonzero == 0 {
+		t.Errorf("biases did not evolve")
+	}
+
+	// biases change development (with the same cue noise).
+	indiv := pop.Indivs[0].Clone(s, envs[1])
+	indiv.Develop(rand.New(rand.NewPCG(1, 2)), s, envs[1])
+	s.WithBias = false
+	indiv0 := indiv.Clone(s, envs[1])
+	indiv0.Develop(rand.New(rand.NewPCG(1, 2)), s, envs[1])
+	p := indiv.Phenotype(s)
+	p0 := indiv0.Phenotype(s)
+	same := true
+	for i, v := range p {
+		if !slices.Equal(v, p0[i]) {
+			same = false
+		}
+	}
+	if same {
+		t.Errorf("biases do not affect the phenotype")
+	}
+}
@@ -0,0 +1,70 @@
+package multicell_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+func TestGRN(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	g0 := s.NewGenome()
+	g1 := s.NewGenome()
+	nnz := 0
+	g0.Do(func(l, k int, mat multicell.SpMat) {
+		mat.Do(func(i, j int, v float64) { nnz++ })
+	})
+
+	grn := s.GenomeGRN(g0)
+	if len(grn.Edges) != nnz {
+		t.Errorf("%d edges; want %d", len(grn.Edges), nnz)
+	}
+	nnodes := 0
+	for _, n := range s.LenLayer {
+		nnodes += n
+	}
+	if len(grn.Nodes) != nnodes {
+		t.Errorf("%d nodes; want %d", len(grn.Nodes), nnodes)
+	}
+
+	cons := s.ConsensusGRN([]multicell.Genome{g0, g0, g1}, 0.5)
+	for _, e := range cons.Edges {
+		if e.Freq < 0.5 || e.Sign == 0 {
+			t.Errorf("bad consensus edge: %+v", e)
+		}
+	}
+	if all := s.ConsensusGRN([]multicell.Genome{g0, g0, g1}, 0); len(all.Edges) <= len(cons.Edges) {
+		t.Errorf("minfreq does not filter edges")
+	}
+
+	var buf bytes.Buffer
+	grn.WriteJSON(&buf)
+	var grn1 multicell.GRN
+	if err := json.Unmarshal(buf.Bytes(), &grn1); err != nil || len(grn1.Edges) != nnz {
+		t.Errorf("JSON: %v", err)
+	}
+
+	buf.Reset()
+	grn.WriteGraphML(&buf)
+	var doc struct {
+		Graph struct {
+			Edges []struct{} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil || len(doc.Graph.Edges) != nnz {
+		t.Errorf("GraphML: %v", err)
+	}
+
+	buf.Reset()
+	grn.WriteDOT(&buf)
+	if n := strings.Count(buf.String(), "->"); n != nnz {
+		t.Errorf("DOT: %d edges; want %d", n, nnz)
+	}
+	if strings.Contains(buf.String(), "weight=") {
+		t.Errorf("DOT: the reserved attribute weight is used")
+	}
+}
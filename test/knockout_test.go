@@ -0,0 +1,50 @@
+package multicell_test
+
+import (
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+func TestKnockout(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.MaxPopulation = 3
+	env := s.NewEnvironment()
+	pop := s.NewPopulation(env)
+	g := pop.Indivs[0].Genome
+
+	nlinks := 0
+	s.Topology.Do(func(l, k int, _ float64) { nlinks++ })
+	for kind, want := range map[string]int{
+		"Link": nlinks,
+		"Row":  nlinks * s.LenLayer[1],
+		"Col":  nlinks * s.LenLayer[1]} {
+		if n := len(s.GetKnockouts(kind, pop.Genomes())); n != want {
+			t.Errorf("%s: %d knockouts; want %d", kind, n, want)
+		}
+	}
+
+	edges := s.GetKnockouts("Edge", []multicell.Genome{g})
+	ko := edges[0]
+	kg := ko.Apply(g)
+	if _, ok := kg.M[ko.L][ko.K].M[ko.I][ko.J]; ok {
+		t.Errorf("%s not knocked out", ko)
+	}
+	if _, ok := g.M[ko.L][ko.K].M[ko.I][ko.J]; !ok {
+		t.Errorf("%s: the original genome is modified", ko)
+	}
+
+	kos := s.GetKnockouts("Link", pop.Genomes())
+	effs := pop.KnockoutEffects(s, env, kos)
+	for i, eff := range effs {
+		if eff.Pheno <= 0 {
+			t.Errorf("%s: no phenotypic change", eff.Knockout)
+		}
+		if i > 0 && eff.Essentiality > effs[i-1].Essentiality {
+			t.Errorf("not sorted by essentiality at %d", i)
+		}
+	}
+	if again := pop.KnockoutEffects(s, env, kos); again[0] != effs[0] {
+		t.Errorf("knockout effects are not reproducible")
+	}
+}
@@ -0,0 +1,155 @@
+package multicell_test
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+func TestLattices(t *testing.T) {
+	nfaces := map[string]int{"Rect": 4, "Torus": 4, "Hex": 6, "HexTorus": 6}
+	nbound := map[string]int{"Rect": 14, "Torus": 0, "Hex": 26, "HexTorus": 0}
+	for name, nf := range nfaces {
+		s := multicell.GetDefaultSetting("Full")
+		s.Lattice = name
+		s.NumCellX = 3
+		s.NumCellY = 4
+		s.SetModel("Full")
+		if s.LenLayer[s.NumLayers-1] != nf*s.LenFace {
+			t.Errorf("%s: output layer of length %d; want %d",
+				name, s.LenLayer[s.NumLayers-1], nf*s.LenFace)
+		}
+		env := s.NewEnvironment()
+		if env.Len() != nf*s.LenFace {
+			t.Errorf("%s: env.Len()= %d; want %d", name, env.Len(), nf*s.LenFace)
+		}
+
+		indiv := s.NewIndividual(s.Rand(), 0, env)
+		nb := 0
+		for _, c := range indiv.Cells {
+			if len(c.Facing) != nf || len(c.Cue) != nf {
+				t.Fatalf("%s: cell %d has %d faces; want %d", name, c.Id, len(c.Facing), nf)
+			}
+			for iface, k := range c.Facing {
+				if k < 0 {
+					nb++
+					continue
+				}
+				iop := s.OppositeFace(iface)
+				if indiv.Cells[k].Facing[iop] != c.Id {
+					t.Errorf("%s: cell %d faces %d through %d, but not vice versa",
+						name, c.Id, k, iface)
+				}
+				if &c.Cue[iface][0] != &indiv.Cells[k].Face(s, iop)[0] {
+					t.Errorf("%s: cue %d of cell %d is not the face of cell %d", name, iface, c.Id, k)
+				}
+			}
+		}
+		if nb != nbound[name] {
+			t.Errorf("%s: %d boundary faces; want %d", name, nb, nbound[name])
+		}
+		if p := indiv.Phenotype(s); len(p) != nb {
+			t.Errorf("%s: phenotype of %d faces; want %d", name, len(p), nb)
+		}
+	}
+}
+
+func TestHexEvolve(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.Lattice = "Hex"
+	s.NumCellX = 2
+	s.NumCellY = 2
+	s.SetModel("Full")
+	s.Outdir = "traj"
+	s.MaxPopulation = 20
+	s.MaxGeneration = 2
+	envs := s.SaveEnvs(ENVSFILE, 2)
+	if envs1 := s.LoadEnvs(ENVSFILE); envs1[1].Len() != multicell.NumHexFaces*s.LenFace {
+		t.Errorf("hexagonal environment of length %d", envs1[1].Len())
+	}
+	pop := s.NewPopulation(envs[0])
+	pop, _ = pop.Evolve(s, envs[1])
+	for _, indiv := range pop.Indivs {
+		if indiv.Align < -1 || indiv.Align > 1 {
+			t.Errorf("alignment %f out of range", indiv.Align)
+		}
+	}
+}
+
+func TestSpatialEnv(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.NumCellX = 2
+	s.NumCellY = 1
+
+	uenv := s.NewEnvironment()
+	s.SpatialEnv = true
+	if n := s.NumBoundaryFaces(); n != 6 {
+		t.Errorf("NumBoundaryFaces()= %d; want 6", n)
+	}
+	senv := uenv.Spatialize(s)
+	if senv.Len() != s.LenEnv() {
+		t.Errorf("spatial env of length %d; want %d", senv.Len(), s.LenEnv())
+	}
+
+	// the same cues and fitness as the uniform environment (without noise).
+	s.EnvNoise = 0
+	g := s.NewGenome()
+	develop := func(env multicell.Environment) multicell.Individual {
+		indiv := s.NewIndividual(rand.New(rand.NewPCG(1, 2)), 0, env)
+		indiv.Genome = g
+		indiv.Develop(rand.New(rand.NewPCG(3, 4)), s, env)
+		return indiv
+	}
+	indiv1 := develop(senv)
+	s.SpatialEnv = false
+	indiv0 := develop(uenv)
+	s.SpatialEnv = true
+	if indiv0.Align != indiv1.Align || indiv0.Fitness != indiv1.Fitness {
+		t.Errorf("Spatialize: (Align, Fitness) = (%f, %f); want (%f, %f)",
+			indiv1.Align, indiv1.Fitness, indiv0.Align, indiv0.Fitness)
+	}
+
+	// cells are scored against their local targets.
+	genv := s.NewSpatialEnvironment("Gradient")
+	benv := s.BoundaryEnv(genv)
+	if slices.Equal(benv[0][multicell.Top], benv[1][multicell.Top]) {
+		t.Errorf("Gradient: the same environment for different cells")
+	}
+	indiv := s.NewIndividual(s.Rand(), 0, genv)
+	for i, c := range indiv.Cells {
+		for iface, iop := range c.Facing {
+			if iop < 0 {
+				copy(c.Face(s, iface), benv[i][iface])
+			}
+		}
+	}
+	s.SelFaces = multicell.Vec{1, 1, 1, 1}
+	if a := s.Alignment(&indiv, genv); a != 1 {
+		t.Errorf("Alignment to the local targets = %f; want 1", a)
+	}
+	if sel := genv.SelectingEnv(s); !slices.Equal(sel, slices.Concat(benv[0][multicell.Left])) {
+		t.Errorf("SelectingEnv of a spatial environment")
+	}
+}
+
+// The layout of the cells is computed once; setting cues and scoring
+// an individual allocate nothing.
+func TestLatticeLayoutCached(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.NumCellX, s.NumCellY = 3, 2
+	s.Lattice = "Hex"
+	s.SetModel("Full")
+	s.SpatialEnv = true
+	env := s.NewSpatialEnvironment("Random")
+	indiv := s.NewIndividual(s.Rand(), 0, env)
+	if n := testing.AllocsPerRun(10, func() {
+		s.SetCellCue(indiv.Cells, env)
+		s.Alignment(&indiv, env)
+		s.LatticeFacing()
+		s.EnvSegmentFaces()
+	}); n != 0 {
+		t.Errorf("%.0f allocations per run; want 0", n)
+	}
+}
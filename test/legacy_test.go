@@ -0,0 +1,42 @@
+package multicell_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+// testdata/baseline_pop.traj.gz was dumped by the code before the cell
+// lattices (Cell.Facing was [4]int): GetDefaultSetting("Full") with
+// MaxPopulation = 2, NewPopulation(NewEnvironment()).
+func TestLoadBaselineDump(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	pop := s.LoadPopulation("testdata/baseline_pop.traj.gz")
+	if len(pop.Indivs) != 2 {
+		t.Fatalf("%d individuals; want 2", len(pop.Indivs))
+	}
+	for i, indiv := range pop.Indivs {
+		if indiv.Id != i || len(indiv.Cells) != 1 {
+			t.Fatalf("individual %d: Id %d with %d cells", i, indiv.Id, len(indiv.Cells))
+		}
+		c := indiv.Cells[0]
+		if !slices.Equal(c.Facing, []int{-1, -1, -1, -1}) {
+			t.Errorf("individual %d: Facing = %v", i, c.Facing)
+		}
+		for l, sl := range c.S {
+			if len(sl) != s.LenLayer[l] {
+				t.Errorf("individual %d: len(S[%d]) = %d; want %d", i, l, len(sl), s.LenLayer[l])
+			}
+		}
+		if len(indiv.Genome.M) != s.NumLayers {
+			t.Errorf("individual %d: genome with %d layers", i, len(indiv.Genome.M))
+		}
+	}
+	pop.Develop(s, s.NewEnvironment())
+	for i, indiv := range pop.Indivs {
+		if indiv.Ndev == 0 {
+			t.Errorf("individual %d did not develop", i)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package multicell_test
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+func TestNetworkMotifs(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	n0 := s.LenLayer[0]
+	g := s.NewGenome()
+	for l := range g.M {
+		for k := range g.M[l] {
+			g.M[l][k] = multicell.NewSpMat(s.LenLayer[l], s.LenLayer[k])
+		}
+	}
+	// units 0, 1, 2 of layer 1 (nodes n0, n0+1, n0+2):
+	// an incoherent feed-forward loop 0->1->2, 0->2 and a negative
+	// feedback loop 0->1->2->0.
+	g.M[1][1].M[1][0] = 1
+	g.M[1][1].M[2][1] = -1
+	g.M[1][1].M[2][0] = 1
+	g.M[1][1].M[0][2] = 1
+	net := s.GenomeNetwork(g)
+	if ncoh, ninc := net.CountFFL(); ncoh != 0 || ninc != 1 {
+		t.Errorf("%d coherent and %d incoherent feed-forward loops; want 0 and 1", ncoh, ninc)
+	}
+	if npos, nneg := net.CountFBL(); npos != 0 || nneg != 1 {
+		t.Errorf("%d positive and %d negative feedback loops; want 0 and 1", npos, nneg)
+	}
+	g.M[1][1].M[2][1] = 1
+	net = s.GenomeNetwork(g)
+	ncoh, _ := net.CountFFL()
+	npos, _ := net.CountFBL()
+	if ncoh != 1 || npos != 1 {
+		t.Errorf("the sign of 1->2 is not reflected in the loops")
+	}
+	g.M[1][1].M[2][1] = -1
+	net = s.GenomeNetwork(g)
+	if len(net.Out[n0]) != 2 || net.Out[n0+1][n0+2] != -1 {
+		t.Errorf("unexpected edges from node %d: %v", n0, net.Out[n0])
+	}
+	stats := s.GetNetStats(s.Rand(), g, 0)
+	if stats.SelfFrac != 1 || stats.FFFrac != 0 {
+		t.Errorf("unexpected block fractions: %+v", stats)
+	}
+}
+
+func TestNetworkRandomize(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	g := s.NewGenome()
+	net := s.GenomeNetwork(g)
+	rnet := net.Randomize(s.Rand())
+	in0, out0 := net.DegreeHist(s.NumLayers)
+	in1, out1 := rnet.DegreeHist(s.NumLayers)
+	for l := range in0 {
+		if !slices.Equal(in0[l], in1[l]) || !slices.Equal(out0[l], out1[l]) {
+			t.Errorf("layer %d: degree distributions changed", l)
+		}
+	}
+	for a := range net.Out {
+		if len(net.Out[a]) != len(rnet.Out[a]) || len(net.In[a]) != len(rnet.In[a]) {
+			t.Fatalf("node %d: degrees changed", a)
+		}
+	}
+	if slices.Equal(net.Edges(), rnet.Edges()) {
+		t.Errorf("the network is not randomized")
+	}
+	// blocks and self-loops are kept
+	block := func(net multicell.Network) map[[2]int]int {
+		count := make(map[[2]int]int)
+		for _, e := range net.Edges() {
+			count[[2]int{net.Layer[e[1]], net.Layer[e[0]]}]++
+			if e[0] == e[1] {
+				count[[2]int{-1, e[0]}]++
+			}
+		}
+		return count
+	}
+	if !maps.Equal(block(net), block(rnet)) {
+		t.Errorf("edges moved between blocks or self-loops changed")
+	}
+
+	stats := s.GetNetStats(s.Rand(), g, 3)
+	if stats.Modularity <= 0 || stats.Modularity >= 1 {
+		t.Errorf("modularity %f out of range", stats.Modularity)
+	}
+	if sum := stats.SelfFrac + stats.FFFrac + stats.FBFrac; sum < 0.999 || sum > 1.001 {
+		t.Errorf("block fractions sum to %f", sum)
+	}
+}
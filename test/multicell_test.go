@@ -4,8 +4,11 @@ import (
 	"fmt"
 	//	"gonum.org/v1/gonum/blas/blas64"
 	"math"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	//	"reflect"
 	//	"slices"
 	"testing"
@@ -41,14 +44,16 @@ func TestMain(m *testing.M) {
 }
 
 func TestSpMatMutate(t *testing.T) {
+	rng := rand.New(rand.NewPCG(13, 97))
 	m0 := multicell.NewSpMat(200, 200)
-	m0.Randomize(0.02)
+	m0.Randomize(rng, 0.02)
 	m1 := m0.Clone()
 	if !m0.Equal(m1) {
 		t.Errorf("Clone failed.")
 	}
 
-	m0.Mutate(0.001, 0.02)
+	// about 16 changes expected; 0.001 would leave ~20% of streams unchanged.
+	m0.Mutate(rng, 0.01, 0.02)
 
 	if m0.Equal(m1) {
 		t.Errorf("Mutation failed.")
@@ -57,6 +62,24 @@ func TestSpMatMutate(t *testing.T) {
 	fmt.Printf("Densities %f %f\n", m0.Density(), m1.Density())
 }
 
+func TestSpMatCSR(t *testing.T) {
+	rng := rand.New(rand.NewPCG(13, 97))
+	m := multicell.NewSpMat(200, 150)
+	m.Randomize(rng, 0.02)
+	m.ScaleBy(0.3)
+	vin := make(multicell.Vec, 150)
+	for j := range vin {
+		vin[j] = rng.NormFloat64()
+	}
+	v0 := multicell.NewVec(200, 0.5)
+	v1 := multicell.NewVec(200, 0.5)
+	v0.MultSpMatVec(m, vin)
+	v1.MultCSRVec(m.ToCSR(), vin)
+	if !slices.Equal(v0, v1) {
+		t.Errorf("CSR product differs from the map-based one")
+	}
+}
+
 func TestSetting(t *testing.T) {
 	for _, model := range MODELS {
 		s := multicell.GetDefaultSetting(model)
@@ -75,7 +98,7 @@ func TestSettingDump(t *testing.T) {
 
 func TestCell(t *testing.T) {
 	s := multicell.GetDefaultSetting("Full")
-	cell := s.NewCell(0)
+	cell := s.NewCell(s.Rand(), 0)
 	if len(cell.Cue) != multicell.NumFaces {
 		t.Errorf("len(cell.Cue)= %d; want %d", len(cell.Cue), multicell.NumFaces)
 	}
@@ -95,7 +118,7 @@ func TestCell(t *testing.T) {
 func TestIndividual(t *testing.T) {
 	s := multicell.GetDefaultSetting("Full")
 	envs := s.SaveEnvs(ENVSFILE, 50)
-	indiv := s.NewIndividual(113, envs[0])
+	indiv := s.NewIndividual(s.Rand(), 113, envs[0])
 	if indiv.Id != 113 {
 		t.Errorf("indiv.Id=%d; want 113", indiv.Id)
 	}
@@ -167,3 +190,145 @@ func TestPopulationDumpJSON(t *testing.T) {
 	pop.Evolve(s, envs[0])
 	pop.DumpJSON(s)
 }
+
+func evolveSmall(nworkers int) multicell.Population {
+	s := multicell.GetDefaultSetting("Full")
+	s.Outdir = "traj"
+	s.MaxPopulation = 20
+	s.MaxGeneration = 3
+	s.NumWorkers = nworkers
+	s.EnvFlip = true
+	s.SetSeed(7)
+	envs := s.SaveEnvs(ENVSFILE, 2)
+	pop := s.NewPopulation(envs[0])
+	pop, _ = pop.Evolve(s, envs[1])
+	return pop
+}
+
+func comparePopulations(t *testing.T, pop0, pop1 multicell.Population) {
+	for i, indiv := range pop0.Indivs {
+		indiv1 := pop1.Indivs[i]
+		if indiv.Id != indiv1.Id || indiv.MomId != indiv1.MomId || indiv.DadId != indiv1.DadId {
+			t.Errorf("indiv %d: (Id, MomId, DadId) = (%d, %d, %d) vs (%d, %d, %d)",
+				i, indiv.Id, indiv.MomId, indiv.DadId,
+				indiv1.Id, indiv1.MomId, indiv1.DadId)
+		}
+		if !indiv.Genome.Equal(indiv1.Genome) {
+			t.Errorf("indiv %d: genomes differ with the same seed", i)
+		}
+		if indiv.Fitness != indiv1.Fitness || indiv.Ndev != indiv1.Ndev {
+			t.Errorf("indiv %d: (Fitness, Ndev) = (%e, %d) vs (%e, %d)",
+				i, indiv.Fitness, indiv.Ndev, indiv1.Fitness, indiv1.Ndev)
+		}
+	}
+}
+
+func TestReproducible(t *testing.T) {
+	comparePopulations(t, evolveSmall(0), evolveSmall(0))
+}
+
+func TestWorkers(t *testing.T) {
+	pop := evolveSmall(1)
+	comparePopulations(t, pop, evolveSmall(7))
+	for i, indiv := range pop.Indivs {
+		if indiv.Id != i {
+			t.Errorf("Indivs[%d].Id = %d; want %d", i, indiv.Id, i)
+		}
+		if indiv.MomId < 0 || indiv.DadId < 0 {
+			t.Errorf("Indivs[%d] has no parents: %d %d", i, indiv.MomId, indiv.DadId)
+		}
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.Outdir = "traj"
+	s.MaxPopulation = 20
+	s.MaxGeneration = 5
+	s.CheckpointEvery = 3
+	s.EnvFlip = true
+	s.SetSeed(11)
+	envs := s.SaveEnvs(ENVSFILE, 2)
+	pop := s.NewPopulation(envs[0])
+	pop0, _ := pop.Evolve(s, envs[1])
+
+	s1, cp := multicell.LoadCheckpoint(s.CheckpointFilename())
+	if cp.Pop.Igen != 3 {
+		t.Errorf("checkpoint at generation %d; want 3", cp.Pop.Igen)
+	}
+	pop1, _ := cp.Resume(s1)
+	comparePopulations(t, pop0, pop1)
+
+	// the generations after the checkpoint are logged once
+	buffer, err := os.ReadFile(s.EnvLogFilename(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(buffer)), "\n")
+	if len(lines) != s.MaxGeneration {
+		t.Fatalf("%d lines in the environment log; want %d", len(lines), s.MaxGeneration)
+	}
+	for igen, line := range lines {
+		var jgen int
+		fmt.Sscan(line, &jgen)
+		if jgen != igen {
+			t.Errorf("line %d of the environment log is of generation %d", igen, jgen)
+		}
+	}
+}
+
+func TestModelSpec(t *testing.T) {
+	for _, model := range MODELS {
+		spec, ok := multicell.BuiltinModelSpec(model)
+		if !ok {
+			t.Fatalf("no built-in model %s", model)
+		}
+		filename := "traj/" + model + ".json"
+		spec.Dump(filename)
+		s0 := multicell.GetDefaultSetting(model)
+		s1 := multicell.GetDefaultSetting(filename)
+		if s1.Basename != model || !slices.Equal(s0.LenLayer, s1.LenLayer) ||
+			!slices.Equal(s0.Omega, s1.Omega) || s0.MaxDevelop != s1.MaxDevelop {
+			t.Errorf("model %s changed by Dump/Load", model)
+		}
+	}
+}
+
+func TestModelFile(t *testing.T) {
+	s := multicell.GetDefaultSetting("../scripts/Hie5.json")
+	if s.NumLayers != 7 || s.Basename != "Hie5" {
+		t.Errorf("NumLayers=%d, Basename=%s; want 7, Hie5", s.NumLayers, s.Basename)
+	}
+	s.Outdir = "traj"
+	s.MaxPopulation = 10
+	s.MaxGeneration = 2
+	envs := s.SaveEnvs(ENVSFILE, 2)
+	pop := s.NewPopulation(envs[0])
+	pop.Evolve(s, envs[0])
+}
+
+func TestActivationSetting(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	if s.Activation[0] != "LCatan" || s.Activation[s.NumLayers-1] != "CStep1" {
+		t.Errorf("default Activation = %v", s.Activation)
+	}
+	envs := s.SaveEnvs(ENVSFILE, 2)
+	develop := func(s *multicell.Setting) multicell.Vec {
+		s.SetSeed(3)
+		indiv := s.NewIndividual(s.Rand(), 0, envs[0])
+		indiv.Genome = s.NewGenome()
+		indiv.Develop(s.Rand(), s, envs[0])
+		return indiv.PhenotypeVec(s)
+	}
+	p0 := develop(s)
+
+	s.Activation = nil // as in older settings files
+	if p := develop(s); !slices.Equal(p, p0) {
+		t.Errorf("settings without Activation should use the defaults")
+	}
+
+	s.Activation = []string{"Tanh", "Tanh", "Tanh", "Tanh", "SStep3"}
+	if p := develop(s); slices.Equal(p, p0) {
+		t.Errorf("Activation has no effect")
+	}
+}
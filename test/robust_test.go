@@ -0,0 +1,38 @@
+package multicell_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+func TestRobustness(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.MaxPopulation = 4
+	env := s.NewEnvironment()
+	pop := s.NewPopulation(env)
+	robs := pop.Robustness(s, env, 3)
+	for i, r := range robs {
+		if r.GenPheno <= 0 || r.EnvPheno <= 0 {
+			t.Errorf("individual %d: no phenotypic change: %+v", i, r)
+		}
+	}
+
+	s.MutRate = 0
+	s.EnvNoise = 0
+	for i, r := range pop.Robustness(s, env, 3) {
+		if r != (multicell.Robustness{}) {
+			t.Errorf("individual %d: change without perturbations: %+v", i, r)
+		}
+	}
+
+	var buf bytes.Buffer
+	multicell.PrintRobustnessHeader(&buf)
+	multicell.PrintRobustness(&buf, 1, 2, robs)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || len(strings.Fields(lines[1])) != 10 {
+		t.Errorf("unexpected table:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,121 @@
+package multicell_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+func TestSampleDistinct(t *testing.T) {
+	rng := rand.New(rand.NewPCG(13, 97))
+	const m, n, ntrial = 10, 3, 30000
+	counts := make([]float64, m)
+	for range ntrial {
+		ps := multicell.SampleDistinct(rng, m, n)
+		slices.Sort(ps)
+		if len(slices.Compact(ps)) != n {
+			t.Fatalf("not distinct: %v", ps)
+		}
+		for _, p := range ps {
+			counts[p]++
+		}
+	}
+	chi2 := 0.0
+	expect := float64(ntrial*n) / m
+	for _, c := range counts {
+		chi2 += (c - expect) * (c - expect) / expect
+	}
+	if chi2 > 27.88 { // p = 0.001 with 9 degrees of freedom
+		t.Errorf("positions are not uniform: chi2 = %f", chi2)
+	}
+	if ps := multicell.SampleDistinct(rng, 5, 8); len(ps) != 5 {
+		t.Errorf("%d positions from 5", len(ps))
+	}
+	big := multicell.SampleDistinct(rng, 1000, 900)
+	slices.Sort(big)
+	if len(slices.Compact(big)) != 900 {
+		t.Errorf("not distinct with many positions")
+	}
+}
+
+// SpMat.Mutate with the former sampling by a full permutation (the reference).
+func permMutate(rng *rand.Rand, sp multicell.SpMat, rate, density float64) {
+	nr, nc := sp.Nrows(), sp.Ncols()
+	n := multicell.Poisson(rng, rate*float64(nr*nc))
+	d2 := density / 2
+	for _, p := range rng.Perm(nr * nc)[:n] {
+		i, j, r := p/nc, p%nc, rng.Float64()
+		if r >= density {
+			delete(sp.M[i], j)
+		} else if v, ok := sp.M[i][j]; ok {
+			if r < d2 {
+				sp.M[i][j] = -v
+			} else {
+				delete(sp.M[i], j)
+			}
+		} else if r < d2 {
+			sp.M[i][j] = 1.0
+		} else {
+			sp.M[i][j] = -1.0
+		}
+	}
+}
+
+// Numbers of changed, positive and negative elements of sp from sp0.
+func mutationCounts(sp0, sp multicell.SpMat) (float64, float64, float64) {
+	changed, pos, neg := 0.0, 0.0, 0.0
+	for i := range sp.Nrows() {
+		for j := range sp.Ncols() {
+			if sp.M[i][j] != sp0.M[i][j] {
+				changed++
+			}
+			switch sp.M[i][j] {
+			case 1:
+				pos++
+			case -1:
+				neg++
+			}
+		}
+	}
+	return changed, pos, neg
+}
+
+func TestMutationSampling(t *testing.T) {
+	rng := rand.New(rand.NewPCG(13, 97))
+	const density, rate, ntrial = 0.1, 0.01, 2000
+	sp0 := multicell.NewSpMat(64, 64)
+	sp0.Randomize(rng, density)
+
+	stats := func(mutate func(multicell.SpMat)) [3]multicell.Vec {
+		var vs [3]multicell.Vec
+		for range ntrial {
+			sp := sp0.Clone()
+			mutate(sp)
+			c, p, n := mutationCounts(sp0, sp)
+			vs[0] = append(vs[0], c)
+			vs[1] = append(vs[1], p)
+			vs[2] = append(vs[2], n)
+		}
+		return vs
+	}
+	now := stats(func(sp multicell.SpMat) { sp.Mutate(rng, rate, density) })
+	ref := stats(func(sp multicell.SpMat) { permMutate(rng, sp, rate, density) })
+	variance := func(v multicell.Vec) float64 {
+		m := v.Mean()
+		s := 0.0
+		for _, x := range v {
+			s += (x - m) * (x - m)
+		}
+		return s / float64(len(v)-1)
+	}
+	for k, name := range []string{"changed", "positive", "negative"} {
+		m0, m1 := now[k].Mean(), ref[k].Mean()
+		se := math.Sqrt((variance(now[k]) + variance(ref[k])) / ntrial)
+		if math.Abs(m0-m1) > 4*se {
+			t.Errorf("%s elements: mean %f; want %f (s.e. %f)", name, m0, m1, se)
+		}
+	}
+}
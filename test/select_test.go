@@ -0,0 +1,88 @@
+package multicell_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/arkinjo/evodevo3/multicell"
+)
+
+func TestSelectors(t *testing.T) {
+	fits := []float64{0.0, 0.1, 0.2, 0.3, 0.4, 1.0, 0.0, 0.5}
+	// schemes that never pick zero fitness here.
+	nonzero := map[string]bool{"Rejection": true, "WrightFisher": true, "Truncation": true}
+	for _, name := range []string{"Rejection", "WrightFisher", "Tournament", "Truncation", "Rank", "MuLambda"} {
+		s := multicell.GetDefaultSetting("Full")
+		s.Selection = name
+		s.SelParam = 0
+		rng := rand.New(rand.NewPCG(1, 2))
+		parents := s.GetSelector().Select(rng, fits, 1000)
+		if len(parents) != 1000 {
+			t.Errorf("%s: %d parents; want 1000", name, len(parents))
+		}
+		for _, i := range parents {
+			if i < 0 || i >= len(fits) {
+				t.Errorf("%s: parent %d out of range", name, i)
+			} else if fits[i] == 0 && nonzero[name] {
+				t.Errorf("%s: parent %d has zero fitness", name, i)
+			}
+		}
+	}
+}
+
+func TestSelectTruncation(t *testing.T) {
+	fits := []float64{0.1, 0.9, 0.2, 0.8}
+	sel := multicell.TruncationSelector{Fraction: 0.5}
+	for _, i := range sel.Select(rand.New(rand.NewPCG(1, 2)), fits, 100) {
+		if i != 1 && i != 3 {
+			t.Errorf("Truncation selected %d; want 1 or 3", i)
+		}
+	}
+}
+
+func TestSelectWrightFisher(t *testing.T) {
+	fits := []float64{1, 3}
+	n := 100000
+	count := 0
+	sel := multicell.WrightFisherSelector{}
+	for _, i := range sel.Select(rand.New(rand.NewPCG(1, 2)), fits, n) {
+		count += i
+	}
+	if p := float64(count) / float64(n); p < 0.74 || p > 0.76 {
+		t.Errorf("WrightFisher: frequency of the fitter %f; want 0.75", p)
+	}
+}
+
+func TestSelectExtinction(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.MaxPopulation = 10
+	envs := s.SaveEnvs(ENVSFILE, 2)
+	pop := s.NewPopulation(envs[0])
+	for i := range pop.Indivs {
+		pop.Indivs[i].Fitness = 0
+	}
+	npop := pop.Select(s) // must not hang
+	if len(npop.Indivs) != s.MaxPopulation {
+		t.Errorf("len(Indivs)=%d; want %d", len(npop.Indivs), s.MaxPopulation)
+	}
+}
+
+func TestElites(t *testing.T) {
+	s := multicell.GetDefaultSetting("Full")
+	s.Outdir = "traj"
+	s.MaxPopulation = 10
+	s.NumElites = 2
+	envs := s.SaveEnvs(ENVSFILE, 2)
+	pop := s.NewPopulation(envs[0])
+	pop.Develop(s, envs[0])
+	elites := pop.Elites(s)
+	kids := pop.Select(s)
+	kids = kids.Reproduce(s)
+	kids.AddElites(s, elites)
+	for k, elite := range elites {
+		kid := kids.Indivs[s.MaxPopulation-1-k]
+		if !kid.Genome.Equal(elite.Genome) || kid.MomId != elite.Id {
+			t.Errorf("elite %d is not carried over", elite.Id)
+		}
+	}
+}